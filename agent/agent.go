@@ -6,15 +6,23 @@ import (
 	"time"
 
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"github.com/kardianos/osext"
 	"github.com/lukesmith/cimple/messages"
+	"github.com/lukesmith/cimple/runner"
 	"github.com/lukesmith/cimple/vcs/git"
 	"github.com/lukesmith/syslog"
 	"github.com/satori/go.uuid"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"sync"
+	"syscall"
 )
 
 const (
@@ -34,13 +42,43 @@ type Config struct {
 	SyslogUrl       string
 	EnableTLS       bool
 	TLSClientConfig *tls.Config
+	// CacheDir is where task caches are kept between builds. Builds are run
+	// in a temporary clone so the cache must live outside of it.
+	CacheDir string
+	// SecretsFile is an encrypted secrets file made available to builds. The
+	// key is read from SecretsKeyFile or, when not set, from the
+	// CIMPLE_SECRETS_KEY environment variable inherited by the build.
+	SecretsFile    string
+	SecretsKeyFile string
 }
 
 func DefaultConfig() (*Config, error) {
 	c := &Config{}
+
+	dir, err := userCacheDir()
+	if err != nil {
+		if dir, err = filepath.Abs(filepath.Join(".cimple", ".cache")); err != nil {
+			return nil, err
+		}
+	}
+	c.CacheDir = filepath.Join(dir, "cimple", "agent", "cache")
+
 	return c, nil
 }
 
+// userCacheDir returns the directory holding the cached data of the user.
+func userCacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); len(dir) != 0 {
+		return dir, nil
+	}
+
+	if home := os.Getenv("HOME"); len(home) != 0 {
+		return filepath.Join(home, ".cache"), nil
+	}
+
+	return "", errors.New("Neither $XDG_CACHE_HOME nor $HOME are defined")
+}
+
 type Agent struct {
 	Id        uuid.UUID
 	config    *Config
@@ -107,6 +145,8 @@ func (agent *Agent) Listen() {
 func (agent *Agent) Start() error {
 	agent.logger.Printf("Starting agent %s", agent)
 
+	go stopBuildOnInterrupt(agent.logger)
+
 	agent.router.OnError(func(m interface{}) {
 		agent.logger.Printf("Received an error routing %+v", m)
 	})
@@ -147,11 +187,17 @@ func (agent *Agent) Start() error {
 		defer s.Close()
 		errWriter := io.MultiWriter(s)
 
-		err = executeCimpleRun(pat, outWriter, errWriter)
+		buildId := runner.NewBuildId()
+		err = executeCimpleRun(pat, buildId, msg.Params, agent.config, outWriter, errWriter)
 		if err != nil {
 			agent.logger.Printf("Err performing Cimple run %+v", err)
 		}
 
+		err = uploadArtifacts(agent, pat, buildId)
+		if err != nil {
+			agent.logger.Printf("Err uploading artifacts %+v", err)
+		}
+
 		err = agent.send(&messages.BuildComplete{})
 		if err != nil {
 			agent.logger.Printf("Err sending build complete %+v", err)
@@ -228,18 +274,91 @@ func (agent Agent) Register() error {
 	})
 }
 
-func executeCimpleRun(workingDir string, stdout io.Writer, stderr io.Writer) error {
-	args := []string{"run", "--run-context", "server", "--journal-driver", "console", "--journal-format", "json"}
+func executeCimpleRun(workingDir string, buildId string, params map[string]string, config *Config, stdout io.Writer, stderr io.Writer) error {
+	args := []string{"run", "--run-context", "server", "--journal-driver", "console", "--journal-format", "json", "--build-id", buildId}
+	if len(config.CacheDir) != 0 {
+		args = append(args, "--cache-dir", config.CacheDir)
+	}
+	if len(config.SecretsFile) != 0 {
+		args = append(args, "--secrets-file", config.SecretsFile)
+	}
+	if len(config.SecretsKeyFile) != 0 {
+		args = append(args, "--secrets-key-file", config.SecretsKeyFile)
+	}
+
+	keys := []string{}
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		args = append(args, "--param", fmt.Sprintf("%s=%s", k, params[k]))
+	}
+
 	filename, _ := osext.Executable()
 	var cmd = exec.Command(filename, args...)
 	cmd.Dir = workingDir
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
-	err := cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	activeRun.Lock()
+	activeRun.cmd = cmd
+	activeRun.done = done
+	activeRun.Unlock()
+
+	err := cmd.Wait()
+
+	activeRun.Lock()
+	activeRun.cmd = nil
+	activeRun.Unlock()
+	close(done)
+
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// activeRun is the cimple run process of the build the agent is running.
+var activeRun struct {
+	sync.Mutex
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// runStopTimeout is how long a stopped build has to kill its steps and
+// services before the agent exits.
+const runStopTimeout = 10 * time.Second
+
+// stopBuildOnInterrupt passes SIGINT or SIGTERM received by the agent on to
+// the running build, so it kills its steps and services, then exits once the
+// build has stopped.
+func stopBuildOnInterrupt(logger *log.Logger) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+
+	activeRun.Lock()
+	cmd, done := activeRun.cmd, activeRun.done
+	activeRun.Unlock()
+
+	if cmd != nil {
+		logger.Printf("Received %s. Stopping the running build", sig)
+		cmd.Process.Signal(syscall.SIGTERM)
+
+		select {
+		case <-done:
+		case <-time.After(runStopTimeout):
+			logger.Printf("The build did not stop within %s", runStopTimeout)
+		}
+	}
+
+	os.Exit(1)
+}
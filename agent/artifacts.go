@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/lukesmith/cimple/artifacts"
+)
+
+// uploadArtifacts sends the artifacts collected during a build to the server.
+func uploadArtifacts(agent *Agent, workingDir string, buildId string) error {
+	manifests, err := filepath.Glob(filepath.Join(workingDir, ".cimple", "*", buildId, "artifacts", artifacts.ManifestFile))
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: agent.config.TLSClientConfig,
+		},
+	}
+
+	for _, m := range manifests {
+		dir := filepath.Dir(m)
+		projectName := filepath.Base(filepath.Dir(filepath.Dir(dir)))
+
+		manifest, err := artifacts.ReadManifest(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range manifest.Artifacts {
+			err := uploadArtifact(agent, client, projectName, buildId, dir, a.Path)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The manifest is uploaded last so the server only lists complete uploads
+		err = uploadArtifact(agent, client, projectName, buildId, dir, artifacts.ManifestFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func uploadArtifact(agent *Agent, client *http.Client, projectName string, buildId string, dir string, path string) error {
+	file, err := os.Open(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	scheme := "http"
+	if agent.config.EnableTLS {
+		scheme = "https"
+	}
+	u := fmt.Sprintf("%s://%s:%s/builds/%s/artifacts/%s?project=%s", scheme, agent.config.ServerAddr, agent.config.ServerPort, buildId, (&url.URL{Path: path}).EscapedPath(), url.QueryEscape(projectName))
+
+	req, err := http.NewRequest("PUT", u, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fi.Size()
+
+	agent.logger.Printf("Uploading artifact %s", path)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("Failed to upload artifact %s. Received %d response - %s", path, res.StatusCode, body)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ManifestFile = "manifest.json"
+)
+
+type Artifact struct {
+	Task   string `json:"task"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+type Manifest struct {
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Collect copies the files matching the patterns into the directory of the
+// task within dest, returning a description of each collected file. Files
+// which would be stored at the same path fail the collection.
+func Collect(task string, patterns []string, dest string) ([]Artifact, error) {
+	collected := []Artifact{}
+	seen := make(map[string]bool)
+	stored := make(map[string]string)
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if info.IsDir() && info.Name() == ".cimple" {
+					return filepath.SkipDir
+				}
+
+				if !info.Mode().IsRegular() || seen[path] {
+					return nil
+				}
+				seen[path] = true
+
+				rel := artifactPath(path)
+				if other, ok := stored[rel]; ok {
+					return fmt.Errorf("Files %s and %s would both be archived as %s", other, path, filepath.ToSlash(rel))
+				}
+				stored[rel] = path
+
+				artifact, err := collectFile(task, path, dest)
+				if err != nil {
+					return err
+				}
+
+				collected = append(collected, *artifact)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return collected, nil
+}
+
+func collectFile(task string, path string, dest string) (*Artifact, error) {
+	rel := filepath.Join(task, artifactPath(path))
+
+	target := filepath.Join(dest, rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(target)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dst, hash), src)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Artifact{
+		Task:   task,
+		Path:   filepath.ToSlash(rel),
+		Size:   size,
+		Sha256: fmt.Sprintf("%x", hash.Sum(nil)),
+	}, nil
+}
+
+// artifactPath determines where a file is stored within the directory of its
+// task. Files outside of the working directory are stored by name.
+func artifactPath(path string) string {
+	if !filepath.IsAbs(path) {
+		if clean := filepath.Clean(path); ValidPath(clean) {
+			return clean
+		}
+		return filepath.Base(path)
+	}
+
+	wd, err := os.Getwd()
+	if err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+
+	return filepath.Base(path)
+}
+
+// ReadManifest reads the manifest within dir. An empty manifest is returned
+// when no artifacts have been collected.
+func ReadManifest(dir string) (*Manifest, error) {
+	manifest := &Manifest{Artifacts: []Artifact{}}
+
+	d, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(d, manifest); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+func WriteManifest(dir string, manifest *Manifest) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	d, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, ManifestFile), d, 0644)
+}
+
+// ValidPath determines whether path refers to a location within the
+// artifacts directory.
+func ValidPath(path string) bool {
+	clean := filepath.Clean(filepath.FromSlash(path))
+	return len(path) != 0 && !filepath.IsAbs(clean) && clean != ".." && !strings.HasPrefix(clean, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,125 @@
+package artifacts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollect(t *testing.T) {
+	assert := assert.New(t)
+
+	src, _ := ioutil.TempDir("", "src")
+	defer os.RemoveAll(src)
+	dest, _ := ioutil.TempDir("", "dest")
+	defer os.RemoveAll(dest)
+
+	os.MkdirAll(filepath.Join(src, "output", "nested"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "output", "cimple.tar.gz"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "output", "nested", "cimple.deb"), []byte("world"), 0644)
+
+	wd, _ := os.Getwd()
+	os.Chdir(src)
+	defer os.Chdir(wd)
+
+	collected, err := Collect("package", []string{"output/*.tar.gz", "output/nested"}, dest)
+	if assert.Nil(err) {
+		assert.Equal([]Artifact{
+			{
+				Task:   "package",
+				Path:   "package/output/cimple.tar.gz",
+				Size:   5,
+				Sha256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			},
+			{
+				Task:   "package",
+				Path:   "package/output/nested/cimple.deb",
+				Size:   5,
+				Sha256: "486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7",
+			},
+		}, collected)
+
+		d, err := ioutil.ReadFile(filepath.Join(dest, "package", "output", "cimple.tar.gz"))
+		if assert.Nil(err) {
+			assert.Equal("hello", string(d))
+		}
+	}
+}
+
+func TestCollect_OutsideWorkingDirectory(t *testing.T) {
+	assert := assert.New(t)
+
+	src, _ := ioutil.TempDir("", "src")
+	defer os.RemoveAll(src)
+	dest, _ := ioutil.TempDir("", "dest")
+	defer os.RemoveAll(dest)
+
+	os.MkdirAll(filepath.Join(src, "work"), 0755)
+	os.MkdirAll(filepath.Join(src, "dist"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "dist", "cimple.tar.gz"), []byte("hello"), 0644)
+
+	wd, _ := os.Getwd()
+	os.Chdir(filepath.Join(src, "work"))
+	defer os.Chdir(wd)
+
+	collected, err := Collect("package", []string{"../dist/*"}, dest)
+	if assert.Nil(err) && assert.Equal(1, len(collected)) {
+		assert.Equal("package/cimple.tar.gz", collected[0].Path)
+
+		_, err := os.Stat(filepath.Join(dest, "package", "cimple.tar.gz"))
+		assert.Nil(err)
+	}
+}
+
+func TestCollect_SameFileNameOutsideWorkingDirectory(t *testing.T) {
+	src, _ := ioutil.TempDir("", "src")
+	defer os.RemoveAll(src)
+	dest, _ := ioutil.TempDir("", "dest")
+	defer os.RemoveAll(dest)
+
+	os.MkdirAll(filepath.Join(src, "work"), 0755)
+	for _, d := range []string{"linux", "darwin"} {
+		os.MkdirAll(filepath.Join(src, d), 0755)
+		ioutil.WriteFile(filepath.Join(src, d, "cimple.tar.gz"), []byte(d), 0644)
+	}
+
+	wd, _ := os.Getwd()
+	os.Chdir(filepath.Join(src, "work"))
+	defer os.Chdir(wd)
+
+	_, err := Collect("package", []string{"../linux/*", "../darwin/*"}, dest)
+	assert.EqualError(t, err, "Files ../linux/cimple.tar.gz and ../darwin/cimple.tar.gz would both be archived as cimple.tar.gz")
+}
+
+func TestManifest(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "manifest")
+	defer os.RemoveAll(dir)
+
+	manifest, err := ReadManifest(dir)
+	if assert.Nil(err) {
+		assert.Empty(manifest.Artifacts)
+	}
+
+	manifest.Artifacts = append(manifest.Artifacts, Artifact{Task: "a", Path: "b", Size: 1, Sha256: "c"})
+	assert.Nil(WriteManifest(dir, manifest))
+
+	read, err := ReadManifest(dir)
+	if assert.Nil(err) {
+		assert.Equal(manifest, read)
+	}
+}
+
+func TestValidPath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(ValidPath("output/cimple.tar.gz"))
+	assert.False(ValidPath("../cimple.tar.gz"))
+	assert.False(ValidPath("output/../../cimple.tar.gz"))
+	assert.False(ValidPath("/etc/passwd"))
+	assert.False(ValidPath(""))
+}
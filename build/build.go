@@ -7,10 +7,18 @@ import (
 	"time"
 
 	"fmt"
+	"github.com/lukesmith/cimple/artifacts"
 	"github.com/lukesmith/cimple/env"
 	"github.com/lukesmith/cimple/logging"
 	"github.com/lukesmith/cimple/project"
+	"github.com/lukesmith/cimple/redact"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 )
 
 type StepContext struct {
@@ -31,18 +39,55 @@ func newStepContext(stepId string, taskEnvs map[string]string, stepConfig projec
 	stepContext.Env.WorkingDir = wd
 	stepContext.Env.Cimple = env.Cimple()
 	stepContext.Env.StepEnv = merge(taskEnvs, stepConfig.GetEnv())
-	stepContext.Env.HostEnv = env.EnvironmentVariables()
+	stepContext.Env.HostEnv = hostEnv()
 	stepContext.Step = stepConfig
 
 	return stepContext
 }
 
+func newTaskVars(config *BuildConfig, task *project.Task, params map[string]string) *project.StepVars {
+	wd, _ := os.Getwd()
+
+	return &project.StepVars{
+		Cimple:     env.Cimple(),
+		BuildDate:  time.Now(),
+		Project:    config.project,
+		Vcs:        config.repoInfo,
+		TaskName:   task.Name,
+		Matrix:     task.Matrix,
+		Params:     params,
+		RunContext: config.RunContext,
+		WorkingDir: wd,
+		BuildDir:   config.BuildPath,
+		HostEnv:    hostEnv(),
+		StepEnv:    merge(config.project.Env, task.Env),
+		Secrets:    config.Secrets,
+	}
+}
+
 type BuildTask struct {
 	Name         string
 	Steps        []StepContext
 	dependencies []string
 	limitTo      string
 	skip         bool
+	baseName     string
+	matrix       map[string]string
+	failFast     bool
+	when         string
+	vars         *project.StepVars
+	archive      []string
+	services     []*project.Service
+	caches       []*project.Cache
+	finally      []StepContext
+	artifacts    []artifacts.Artifact
+	// unsetParams are the params which must be supplied before the task can
+	// run, reported once its condition is met.
+	unsetParams []string
+	// output receives the output of the task, prefixed with the task name when
+	// tasks run in parallel.
+	output io.Writer
+	logger *log.Logger
 }
 
 func (bt BuildTask) GetID() string {
@@ -54,10 +99,18 @@ func (bt BuildTask) GetDependencies() []string {
 }
 
 type Build struct {
-	ID     int
-	tasks  map[string]*BuildTask
-	config *BuildConfig
-	logger *log.Logger
+	ID       int
+	tasks    map[string]*BuildTask
+	config   *BuildConfig
+	logger   *log.Logger
+	manifest *artifacts.Manifest
+	outputs  project.Outputs
+	redactor *redact.Redactor
+	state    *BuildState
+	// started are the tasks which have started, in the order they started.
+	started []*BuildTask
+	// mu guards the state shared by tasks running in parallel.
+	mu sync.Mutex
 }
 
 func contains(s []string, e string) bool {
@@ -72,12 +125,39 @@ func contains(s []string, e string) bool {
 func NewBuild(config *BuildConfig) (*Build, error) {
 	build := new(Build)
 	build.config = config
+	if config.Parallel > 1 {
+		config.logWriter = logging.NewSyncWriter(config.logWriter)
+		config.journal = &syncJournal{journal: config.journal}
+	}
 	build.logger = logging.CreateLogger("Build", config.logWriter)
 	build.ID = 1
 	build.tasks = make(map[string]*BuildTask)
+	build.manifest = &artifacts.Manifest{Artifacts: []artifacts.Artifact{}}
+	build.outputs = project.Outputs{}
+	build.state = newBuildState()
+	if config.Resume != nil {
+		for name, state := range config.Resume.Tasks {
+			build.state.Tasks[name] = state
+		}
+	}
+	build.redactor = redact.New()
+
+	if config.Secrets != nil {
+		config.Secrets = &redactingSecretStore{store: config.Secrets, redactor: build.redactor}
+	}
+
+	params, unsetParams, err := resolveParams(config)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, task := range config.tasks {
-		contexts, err := buildStepContexts(build.logger, build.config, task)
+		contexts, err := buildStepContexts(build.logger, build.config, task, params[task.Name])
+		if err != nil {
+			return nil, err
+		}
+
+		finally, err := newStepContexts(build.config, task, params[task.Name], task.FinallyOrder, task.Finally)
 		if err != nil {
 			return nil, err
 		}
@@ -88,6 +168,22 @@ func NewBuild(config *BuildConfig) (*Build, error) {
 			skip:         task.Skip,
 			dependencies: task.Depends,
 			limitTo:      task.LimitTo,
+			baseName:     task.BaseName,
+			matrix:       task.Matrix,
+			failFast:     task.FailFast,
+			when:         task.When,
+			vars:         newTaskVars(build.config, task, params[task.Name]),
+			archive:      task.Archive,
+			services:     task.Services,
+			caches:       task.Caches,
+			finally:      finally,
+			unsetParams:  unsetParams[task.Name],
+			output:       config.logWriter,
+			logger:       build.logger,
+		}
+		if config.Parallel > 1 {
+			buildTask.output = logging.NewPrefixWriter(config.logWriter, fmt.Sprintf("[%s] ", task.Name))
+			buildTask.logger = logging.CreateLogger("Build", buildTask.output)
 		}
 		build.tasks[task.Name] = buildTask
 	}
@@ -95,25 +191,139 @@ func NewBuild(config *BuildConfig) (*Build, error) {
 	return build, nil
 }
 
-func (build *Build) checkSkip(task *BuildTask) (string, bool) {
-	if len(build.config.ExplicitTasks) != 0 {
-		if contains(build.config.ExplicitTasks, task.Name) {
-			if task.skip {
-				build.logger.Printf("Unskipping task %s as explicitly specified", task.Name)
-				return "", false
+// resolveParams validates the supplied params against those declared by each
+// task, returning the values for each task. Params without a value are only
+// required for tasks which will run. Those of a task with a condition are
+// returned as unset rather than failing the build, as whether the task runs
+// is only known once its condition is evaluated.
+func resolveParams(config *BuildConfig) (map[string]map[string]string, map[string][]string, error) {
+	result := make(map[string]map[string]string)
+	unset := make(map[string][]string)
+	issues := []string{}
+	declared := make(map[string]bool)
+
+	for _, task := range config.tasks {
+		name := task.Name
+		if len(task.BaseName) != 0 {
+			name = task.BaseName
+		}
+		declared[name] = true
+
+		required := len(skipReason(config, &BuildTask{Name: task.Name, baseName: task.BaseName, matrix: task.Matrix, skip: task.Skip, limitTo: task.LimitTo})) == 0
+		conditional := len(task.When) != 0
+
+		resolved, taskIssues := task.ResolveParams(config.Params[name], required && !conditional)
+		issues = append(issues, taskIssues...)
+		result[task.Name] = resolved
+
+		if required && conditional {
+			if _, taskMissing := task.ResolveParams(config.Params[name], true); len(taskMissing) != 0 {
+				unset[task.Name] = taskMissing
+			}
+		}
+	}
+
+	for name := range config.Params {
+		if !declared[name] {
+			issues = append(issues, fmt.Sprintf("Params were supplied for unknown task %s", name))
+		}
+	}
+
+	if len(issues) != 0 {
+		return nil, nil, &project.ConfigError{Issues: uniqueSorted(issues)}
+	}
+
+	return result, unset, nil
+}
+
+func uniqueSorted(s []string) []string {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// isSelected determines whether a task matches one of the selectors. A selector
+// may name a task directly or select matrix variants, e.g. test[go=1.8].
+func isSelected(selectors []string, task *BuildTask) bool {
+	if contains(selectors, task.Name) {
+		return true
+	}
+
+	if len(task.baseName) == 0 {
+		return false
+	}
+
+	for _, selector := range selectors {
+		name, values, err := project.ParseTaskSelector(selector)
+		if err != nil || name != task.baseName {
+			continue
+		}
+
+		matches := true
+		for k, v := range values {
+			if task.matrix[k] != v {
+				matches = false
+				break
 			}
-		} else {
-			build.logger.Printf("Skipping task %s as not explicitly specified", task.Name)
-			return "Explicit tasks defined", true
+		}
+
+		if matches {
+			return true
 		}
 	}
 
-	if len(task.limitTo) != 0 && task.limitTo != build.config.RunContext {
-		build.logger.Printf("Skipping task %s. Is limited to run in %s context. Current context is %s", task.Name, task.limitTo, build.config.RunContext)
-		return "Outside of run context", true
+	return false
+}
+
+func (build *Build) checkSkip(task *BuildTask) (string, bool) {
+	reason := skipReason(build.config, task)
+
+	switch reason {
+	case "":
+		if task.skip {
+			task.logger.Printf("Unskipping task %s as explicitly specified", task.Name)
+		}
+		return "", false
+	case reasonNotSelected:
+		task.logger.Printf("Skipping task %s as not explicitly specified", task.Name)
+	case reasonSkipped:
+		task.logger.Printf("Skipping task %s as it is marked to be skipped", task.Name)
+	case reasonOutsideContext:
+		task.logger.Printf("Skipping task %s. Is limited to run in %s context. Current context is %s", task.Name, task.limitTo, build.config.RunContext)
+	}
+
+	return reason, true
+}
+
+const (
+	reasonNotSelected    = "Explicit tasks defined"
+	reasonSkipped        = "Task is marked to be skipped"
+	reasonOutsideContext = "Outside of run context"
+)
+
+// skipReason returns why the task will not run, or an empty string when it
+// will. A skipped task only runs when explicitly selected.
+func skipReason(config *BuildConfig, task *BuildTask) string {
+	if len(config.ExplicitTasks) != 0 {
+		if !isSelected(config.ExplicitTasks, task) {
+			return reasonNotSelected
+		}
+	} else if task.skip {
+		return reasonSkipped
 	}
 
-	return "", false
+	if len(task.limitTo) != 0 && task.limitTo != config.RunContext {
+		return reasonOutsideContext
+	}
+
+	return ""
 }
 
 func (build *Build) Run() error {
@@ -125,12 +335,63 @@ func (build *Build) Run() error {
 		tasks = append(tasks, t)
 	}
 
+	failed := make(map[string]bool)
+	failures := []string{}
+
 	buildStrategy := NewBuildStrategy(tasks)
+	if build.config.Parallel > 1 {
+		buildStrategy = NewParallelBuildStrategy(tasks, build.config.Parallel)
+	}
+
 	err := buildStrategy.Build(func(taskName string) error {
-		return build.runTask(build.tasks[taskName])
+		task := build.tasks[taskName]
+
+		if build.resumeTask(task) {
+			return nil
+		}
+
+		build.mu.Lock()
+		for _, d := range task.dependencies {
+			if failed[d] {
+				build.config.journal.Record(taskSkipped{Id: task.Name, Reason: fmt.Sprintf("Dependency %s failed", d)})
+				failed[task.Name] = true
+				build.mu.Unlock()
+				return nil
+			}
+		}
+		build.mu.Unlock()
+
+		err := build.runTask(task)
+		if err != nil {
+			build.saveState(task, TaskFailed)
+			build.mu.Lock()
+			failed[task.Name] = true
+			build.mu.Unlock()
+		}
+		if err != nil && len(task.baseName) != 0 && !task.failFast {
+			// Allow the remaining matrix variants to run, failing the build once they complete.
+			task.logger.Printf("Task %s failed - %s", task.Name, build.redactor.Redact(err.Error()))
+			build.mu.Lock()
+			failures = append(failures, task.Name)
+			build.mu.Unlock()
+			return nil
+		}
+
+		return err
 	})
+	build.skipDependents(failed)
+
+	finallyErr := build.runFinally()
 	if err != nil {
-		return err
+		return build.redactError(err)
+	}
+
+	if len(failures) != 0 {
+		return fmt.Errorf("Tasks failed: %s", strings.Join(failures, ", "))
+	}
+
+	if finallyErr != nil {
+		return build.redactError(finallyErr)
 	}
 
 	build.config.journal.Record("Build finished successfully")
@@ -138,13 +399,71 @@ func (build *Build) Run() error {
 	return nil
 }
 
+// redactError removes any secrets from an error before it leaves the build.
+func (build *Build) redactError(err error) error {
+	return errors.New(build.redactor.Redact(err.Error()))
+}
+
+// skipDependents records the tasks which were not run as a task they depend on
+// failed.
+func (build *Build) skipDependents(failed map[string]bool) {
+	names := []string{}
+	for name := range build.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for skipped := true; skipped; {
+		skipped = false
+		for _, name := range names {
+			if failed[name] {
+				continue
+			}
+
+			for _, d := range build.tasks[name].dependencies {
+				if failed[d] {
+					build.config.journal.Record(taskSkipped{Id: name, Reason: fmt.Sprintf("Dependency %s failed", d)})
+					failed[name] = true
+					skipped = true
+					break
+				}
+			}
+		}
+	}
+}
+
 func (build *Build) runTask(task *BuildTask) error {
+	if w, ok := task.output.(*logging.PrefixWriter); ok {
+		defer w.Flush()
+	}
+
 	if reason, skip := build.checkSkip(task); skip {
 		build.config.journal.Record(taskSkipped{Id: task.Name, Reason: reason})
 		return nil
 	}
 
-	build.logger.Printf("Running task %s", task.Name)
+	task.vars.Outputs = build.visibleOutputs(task)
+
+	if len(task.when) != 0 {
+		met, err := project.EvaluateCondition(task.when, *task.vars)
+		if err != nil {
+			build.config.journal.Record(taskFailed{Id: task.Name})
+			return err
+		}
+
+		if !met {
+			task.logger.Printf("Skipping task %s. Condition %s was not met", task.Name, task.when)
+			build.config.journal.Record(taskSkipped{Id: task.Name, Reason: fmt.Sprintf("Condition not met - %s", task.when)})
+			return nil
+		}
+	}
+
+	if len(task.unsetParams) != 0 {
+		build.config.journal.Record(taskFailed{Id: task.Name})
+		return &project.ConfigError{Issues: task.unsetParams}
+	}
+
+	task.logger.Printf("Running task %s", task.Name)
 	stepIds := []string{}
 
 	for _, step := range task.Steps {
@@ -153,30 +472,452 @@ func (build *Build) runTask(task *BuildTask) error {
 
 	build.config.journal.Record(taskStarted{Id: task.Name, Steps: stepIds})
 
+	build.mu.Lock()
+	build.started = append(build.started, task)
+	build.mu.Unlock()
+
+	cacheKeys, err := build.restoreCaches(task)
+	if err != nil {
+		build.config.journal.Record(taskFailed{Id: task.Name})
+		return err
+	}
+
+	serviceOutput := build.redactor.Writer(task.output)
+	services, err := build.startServices(task, serviceOutput)
+	defer func() {
+		build.stopServices(task, services)
+		serviceOutput.Flush()
+	}()
+	if err != nil {
+		build.config.journal.Record(taskFailed{Id: task.Name})
+		return err
+	}
+
+	exports := make(map[string]string)
+	for _, service := range services {
+		exports = merge(exports, service.Exports())
+	}
+
+	var taskErr error
 	for _, stepContext := range task.Steps {
-		stepType := reflect.TypeOf(stepContext.Step).Name()
-		build.config.journal.Record(stepStarted{Id: stepContext.Id, Env: stepContext.Env, StepType: stepType, Step: stepContext.Step})
-		err := stepContext.Step.Execute(*stepContext.Env, build.config.logWriter, build.config.logWriter)
+		if taskErr != nil && !stepContext.Step.GetAlways() {
+			build.config.journal.Record(skipStep{Id: stepContext.Id, Reason: "An earlier step failed"})
+			continue
+		}
+
+		stepContext.Env.StepEnv = merge(exports, stepContext.Env.StepEnv)
+		if err := build.runStep(task, stepContext); err != nil && taskErr == nil {
+			taskErr = err
+		}
+	}
+
+	if taskErr != nil {
+		build.config.journal.Record(taskFailed{Id: task.Name})
+		return taskErr
+	}
+
+	if err := build.archiveTask(task); err != nil {
+		build.config.journal.Record(taskFailed{Id: task.Name})
+		return err
+	}
+
+	build.saveCaches(task, cacheKeys)
+
+	build.saveState(task, TaskSucceeded)
+	build.config.journal.Record(taskSuccessful{Id: task.Name})
+	return nil
+}
+
+// resumeTask reuses the outputs and artifacts of a task which succeeded before
+// the build was resumed, rather than running the task again.
+func (build *Build) resumeTask(task *BuildTask) bool {
+	if build.config.Resume == nil || !build.config.Resume.Succeeded(task.Name) {
+		return false
+	}
+
+	state := build.config.Resume.Tasks[task.Name]
+	task.logger.Printf("Skipping task %s as it succeeded before the build was resumed", task.Name)
+
+	build.mu.Lock()
+	for step, outputs := range state.Outputs {
+		build.outputs.Set(task.Name, step, outputs)
+	}
+	build.manifest.Artifacts = append(build.manifest.Artifacts, state.Artifacts...)
+	build.mu.Unlock()
+
+	build.config.journal.Record(taskSkipped{Id: task.Name, Reason: "Succeeded before the build was resumed"})
+	return true
+}
+
+// saveState records the outcome of the task, along with its outputs and
+// artifacts, so a failed build can be resumed.
+func (build *Build) saveState(task *BuildTask, status string) {
+	build.mu.Lock()
+	defer build.mu.Unlock()
+
+	outputs := make(map[string]map[string]string)
+	for step, values := range build.outputs[task.Name] {
+		outputs[step] = values
+	}
+
+	build.state.Tasks[task.Name] = &TaskState{Status: status, Outputs: outputs, Artifacts: task.artifacts}
+	build.writeState()
+}
+
+// writeState writes the state of the build to the build path. It must be
+// called with mu held.
+func (build *Build) writeState() {
+	if len(build.config.BuildPath) == 0 {
+		return
+	}
+
+	if err := build.state.write(build.config.BuildPath); err != nil {
+		build.logger.Printf("Unable to record the state of the build - %s", err)
+	}
+}
+
+// runStep runs a step of the task, recording its outputs. A failure of a step
+// which is allowed to fail is recorded and nil returned.
+func (build *Build) runStep(task *BuildTask, stepContext StepContext) error {
+	err := build.attemptStep(task, stepContext)
+	if err == nil {
+		return nil
+	}
+
+	if stepContext.Step.GetAllowFailure() {
+		task.logger.Printf("Step %s failed but is allowed to fail - %s", stepContext.Id, build.redactor.Redact(err.Error()))
+		build.config.journal.Record(stepFailureAllowed{Id: stepContext.Id, Reason: build.redactor.Redact(err.Error())})
+		return nil
+	}
+
+	build.config.journal.Record(stepFailed{Id: stepContext.Id})
+	return err
+}
+
+func (build *Build) attemptStep(task *BuildTask, stepContext StepContext) error {
+	stepContext.Env.Outputs = build.visibleOutputs(task)
+
+	if when := stepContext.Step.GetWhen(); len(when) != 0 {
+		met, err := project.EvaluateCondition(when, *stepContext.Env)
 		if err != nil {
-			build.config.journal.Record(stepFailed{Id: stepContext.Id})
-			build.config.journal.Record(taskFailed{Id: task.Name})
 			return err
 		}
 
-		build.config.journal.Record(stepSuccessful{Id: stepContext.Id})
+		if !met {
+			build.config.journal.Record(skipStep{Id: stepContext.Id, Reason: fmt.Sprintf("Condition not met - %s", when)})
+			return nil
+		}
 	}
 
-	build.config.journal.Record(taskSuccessful{Id: task.Name})
+	outputFile, cleanup, err := build.createOutputFile(task, stepContext)
+	if err != nil {
+		return err
+	}
+	stepContext.Env.OutputFile = outputFile
+
+	stepType := reflect.TypeOf(stepContext.Step).Name()
+	build.config.journal.Record(stepStarted{Id: stepContext.Id, Env: build.redactVars(stepContext.Env), StepType: stepType, Step: stepContext.Step})
+	err = build.executeStep(task, stepContext)
+	var outputs map[string]string
+	if err == nil {
+		outputs, err = project.ReadOutputFile(outputFile)
+	}
+	cleanup()
+	if err != nil {
+		return err
+	}
+
+	build.mu.Lock()
+	build.outputs.Set(task.Name, stepContext.Step.GetName(), outputs)
+	build.mu.Unlock()
+	build.config.journal.Record(stepSuccessful{Id: stepContext.Id, Outputs: build.redactor.RedactMap(outputs)})
+
 	return nil
 }
 
-func buildStepContexts(logger *log.Logger, config *BuildConfig, task *project.Task) ([]StepContext, error) {
+// runFinally runs the finally steps of each task which started, whatever the
+// outcome of the build, returning the first failure.
+func (build *Build) runFinally() error {
+	var finallyErr error
+
+	for _, task := range build.started {
+		if len(task.finally) == 0 {
+			continue
+		}
+
+		task.logger.Printf("Running finally steps of task %s", task.Name)
+		for _, stepContext := range task.finally {
+			if err := build.runStep(task, stepContext); err != nil && finallyErr == nil {
+				finallyErr = err
+			}
+		}
+
+		if w, ok := task.output.(*logging.PrefixWriter); ok {
+			w.Flush()
+		}
+	}
+
+	return finallyErr
+}
+
+// redactVars returns a copy of the step variables with the secrets retrieved
+// so far masked, so they can be journaled.
+func (build *Build) redactVars(vars *project.StepVars) *project.StepVars {
+	redacted := *vars
+	redacted.HostEnv = build.redactor.RedactMap(vars.HostEnv)
+	redacted.StepEnv = build.redactor.RedactMap(vars.StepEnv)
+	redacted.Params = build.redactor.RedactMap(vars.Params)
+
+	if vars.Outputs != nil {
+		redacted.Outputs = project.Outputs{}
+		for task, steps := range vars.Outputs {
+			for step, values := range steps {
+				redacted.Outputs.Set(task, step, build.redactor.RedactMap(values))
+			}
+		}
+	}
+
+	return &redacted
+}
+
+// createOutputFile creates the empty file a step writes its outputs to. The
+// file is kept within the build directory, or removed by cleanup when there
+// is no build directory.
+func (build *Build) createOutputFile(task *BuildTask, stepContext StepContext) (string, func(), error) {
+	if len(build.config.BuildPath) == 0 {
+		f, err := ioutil.TempFile("", "cimple-output")
+		if err != nil {
+			return "", nil, err
+		}
+		f.Close()
+		return f.Name(), func() { os.Remove(f.Name()) }, nil
+	}
+
+	path, err := filepath.Abs(filepath.Join(build.config.BuildPath, "outputs", task.Name, stepContext.Step.GetName()))
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", nil, err
+	}
+
+	if err := ioutil.WriteFile(path, []byte{}, 0644); err != nil {
+		return "", nil, err
+	}
+
+	return path, func() {}, nil
+}
+
+// visibleOutputs returns the outputs available to the task, being its own and
+// those of the tasks it depends on, directly or otherwise.
+func (build *Build) visibleOutputs(task *BuildTask) project.Outputs {
+	build.mu.Lock()
+	defer build.mu.Unlock()
+
+	visible := project.Outputs{}
+	seen := make(map[string]bool)
+
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+
+		if steps, ok := build.outputs[name]; ok {
+			for step, values := range steps {
+				visible.Set(name, step, values)
+			}
+		}
+
+		if t, ok := build.tasks[name]; ok {
+			for _, d := range t.dependencies {
+				visit(d)
+			}
+		}
+	}
+	visit(task.Name)
+
+	return visible
+}
+
+// restoreCaches restores the caches of the task, returning the rendered key of
+// each cache so the same keys are used when saving. Failing to restore a cache
+// does not fail the task.
+func (build *Build) restoreCaches(task *BuildTask) (map[string]string, error) {
+	keys := make(map[string]string)
+	if build.config.Cache == nil {
+		return keys, nil
+	}
+
+	for _, c := range task.caches {
+		id := fmt.Sprintf("%s.%s", task.Name, c.Name)
+
+		key, err := c.RenderKey(*task.vars)
+		if err != nil {
+			return nil, err
+		}
+		keys[c.Name] = key
+
+		restored, err := build.config.Cache.Restore(build.cacheName(c), key, c.Paths, task.vars.WorkingDir)
+		if err != nil {
+			task.logger.Printf("Unable to restore cache %s - %s", id, err)
+		}
+
+		build.config.journal.Record(cacheRestored{Id: id, Key: key, Hit: restored})
+	}
+
+	return keys, nil
+}
+
+// saveCaches saves the caches of a successful task and evicts the least
+// recently used entries. Failing to save a cache does not fail the task.
+func (build *Build) saveCaches(task *BuildTask, keys map[string]string) {
+	if build.config.Cache == nil || len(task.caches) == 0 {
+		return
+	}
+
+	for _, c := range task.caches {
+		id := fmt.Sprintf("%s.%s", task.Name, c.Name)
+
+		saved, err := build.config.Cache.Save(build.cacheName(c), keys[c.Name], c.Paths, task.vars.WorkingDir)
+		if err != nil {
+			task.logger.Printf("Unable to save cache %s - %s", id, err)
+			continue
+		}
+
+		if saved {
+			build.config.journal.Record(cacheSaved{Id: id, Key: keys[c.Name]})
+		}
+	}
+
+	build.mu.Lock()
+	evicted, err := build.config.Cache.Evict()
+	build.mu.Unlock()
+	if err != nil {
+		task.logger.Printf("Unable to evict cache entries - %s", err)
+	}
+	for _, e := range evicted {
+		task.logger.Printf("Evicted cache entry %s", e)
+	}
+}
+
+// cacheName qualifies the name of a cache by the project as a cache directory
+// may be shared by several projects, e.g. on an agent.
+func (build *Build) cacheName(c *project.Cache) string {
+	if len(build.config.project.Name) == 0 {
+		return c.Name
+	}
+
+	return fmt.Sprintf("%s-%s", build.config.project.Name, c.Name)
+}
+
+// startServices starts the services of the task in order, returning those
+// which were started so they can be stopped even when a later service fails.
+func (build *Build) startServices(task *BuildTask, output io.Writer) ([]*project.RunningService, error) {
+	running := []*project.RunningService{}
+
+	for _, service := range task.services {
+		id := fmt.Sprintf("%s.%s", task.Name, service.Name)
+		task.logger.Printf("Starting service %s", id)
+
+		rs, err := service.Start(*task.vars, output, output)
+		if err != nil {
+			build.config.journal.Record(serviceFailed{Id: id, Reason: build.redactor.Redact(err.Error())})
+			return running, err
+		}
+
+		build.config.journal.Record(serviceStarted{Id: id})
+		running = append(running, rs)
+	}
+
+	return running, nil
+}
+
+func (build *Build) stopServices(task *BuildTask, services []*project.RunningService) {
+	for i := len(services) - 1; i >= 0; i-- {
+		id := fmt.Sprintf("%s.%s", task.Name, services[i].Service.Name)
+		task.logger.Printf("Stopping service %s", id)
+		services[i].Stop()
+		build.config.journal.Record(serviceStopped{Id: id})
+	}
+}
+
+// archiveTask collects the artifacts of a successful task into the build's
+// artifacts directory.
+func (build *Build) archiveTask(task *BuildTask) error {
+	if len(task.archive) == 0 || len(build.config.ArtifactsPath) == 0 {
+		return nil
+	}
+
+	collected, err := artifacts.Collect(task.Name, task.archive, build.config.ArtifactsPath)
+	if err != nil {
+		return fmt.Errorf("Unable to archive artifacts for task %s - %s", task.Name, err)
+	}
+
+	task.artifacts = collected
+
+	build.mu.Lock()
+	build.manifest.Artifacts = append(build.manifest.Artifacts, collected...)
+	err = artifacts.WriteManifest(build.config.ArtifactsPath, build.manifest)
+	build.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	build.config.journal.Record(taskArchived{Id: task.Name, Artifacts: collected})
+	return nil
+}
+
+var sleep = time.Sleep
+
+// executeStep runs the step, retrying failed attempts as specified by the step.
+func (build *Build) executeStep(task *BuildTask, stepContext StepContext) error {
+	retry := stepContext.Step.GetRetry()
+	attempts := retry.GetAttempts()
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		build.config.journal.Record(stepAttemptStarted{Id: stepContext.Id, Attempt: attempt})
+		// Only the outputs of the last attempt are kept.
+		if len(stepContext.Env.OutputFile) != 0 {
+			if err := ioutil.WriteFile(stepContext.Env.OutputFile, []byte{}, 0644); err != nil {
+				return err
+			}
+		}
+
+		output := build.redactor.Writer(task.output)
+		err = stepContext.Step.Execute(*stepContext.Env, output, output)
+		output.Flush()
+		if err == nil {
+			return nil
+		}
+
+		build.config.journal.Record(stepAttemptFailed{Id: stepContext.Id, Attempt: attempt, Reason: build.redactor.Redact(err.Error())})
+
+		if attempt < attempts {
+			backoff := retry.GetBackoff(attempt)
+			task.logger.Printf("Step %s failed on attempt %d of %d. Retrying in %s", stepContext.Id, attempt, attempts, backoff)
+			sleep(backoff)
+		}
+	}
+
+	return err
+}
+
+func buildStepContexts(logger *log.Logger, config *BuildConfig, task *project.Task, params map[string]string) ([]StepContext, error) {
+	return newStepContexts(config, task, params, task.StepOrder, task.Steps)
+}
+
+// newStepContexts creates the contexts of the steps of a task in the given order.
+func newStepContexts(config *BuildConfig, task *project.Task, params map[string]string, order []string, steps map[string]project.Step) ([]StepContext, error) {
 	var contexts []StepContext
 
 	taskEnvs := merge(config.project.Env, task.Env)
 
-	for _, stepName := range task.StepOrder {
-		step, found := task.Steps[stepName]
+	for _, stepName := range order {
+		step, found := steps[stepName]
 
 		if !found {
 			// TODO: include list of possible step names in error
@@ -186,16 +927,21 @@ func buildStepContexts(logger *log.Logger, config *BuildConfig, task *project.Ta
 		stepId := fmt.Sprintf("%s.%s", task.Name, stepName)
 
 		if step.GetSkip() {
-			config.journal.Record(skipStep{Id: stepId})
+			config.journal.Record(skipStep{Id: stepId, Reason: "Step is set to skip"})
 			continue
 		}
 
 		stepContext := newStepContext(stepId, taskEnvs, step)
 		stepContext.logger = logging.CreateLogger("Step", config.logWriter)
 		stepContext.Env.TaskName = task.Name
+		stepContext.Env.Matrix = task.Matrix
+		stepContext.Env.Params = params
+		stepContext.Env.RunContext = config.RunContext
+		stepContext.Env.BuildDir = config.BuildPath
 		stepContext.Env.Project = config.project
 		stepContext.Env.Vcs = config.repoInfo
 		stepContext.Env.Secrets = config.Secrets
+		stepContext.Env.DryRunPublish = config.DryRunPublish
 
 		contexts = append(contexts, *stepContext)
 	}
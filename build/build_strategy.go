@@ -133,3 +133,93 @@ func (bs buildStrategy) processNode(rc *runnerContext, node goraph.Node) error {
 
 	return nil
 }
+
+type parallelBuildStrategy struct {
+	graph       goraph.Graph
+	parallelism int
+}
+
+// NewParallelBuildStrategy creates a strategy running up to parallelism tasks
+// at a time. A task is started once all of its dependencies have been built.
+// When a task fails the tasks depending on it are not started, while those
+// independent of it keep running, and the first failure is returned once they
+// complete.
+func NewParallelBuildStrategy(tasks []TaskNode, parallelism int) BuildStrategy {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	return &parallelBuildStrategy{
+		graph:       PopulateGraph(tasks),
+		parallelism: parallelism,
+	}
+}
+
+type taskResult struct {
+	name string
+	err  error
+}
+
+func (bs parallelBuildStrategy) Build(runner func(taskName string) error) error {
+	pending := make(map[string]int)
+	for id := range bs.graph.GetNodes() {
+		sources, err := bs.graph.GetSources(id)
+		if err != nil {
+			return err
+		}
+		pending[id.String()] = len(sources)
+	}
+
+	ready := []string{}
+	for _, node := range Entrypoints(bs.graph) {
+		ready = append(ready, node.String())
+	}
+
+	results := make(chan taskResult)
+	running := 0
+	var buildErr error
+
+	for {
+		for len(ready) != 0 && running < bs.parallelism {
+			name := ready[0]
+			ready = ready[1:]
+			running++
+
+			go func(name string) {
+				results <- taskResult{name: name, err: runner(name)}
+			}(name)
+		}
+
+		if running == 0 {
+			return buildErr
+		}
+
+		result := <-results
+		running--
+
+		if result.err != nil {
+			if buildErr == nil {
+				buildErr = result.err
+			}
+			continue
+		}
+
+		targets, err := bs.graph.GetTargets(goraph.StringID(result.name))
+		if err != nil && buildErr == nil {
+			buildErr = err
+		}
+
+		nodes := []goraph.Node{}
+		for _, t := range targets {
+			nodes = append(nodes, t)
+		}
+		sort.Sort(nodeSorter{nodes: nodes})
+
+		for _, t := range nodes {
+			pending[t.String()]--
+			if pending[t.String()] == 0 {
+				ready = append(ready, t.String())
+			}
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package build
 
 import (
+	"fmt"
 	"github.com/gyuho/goraph"
 	"github.com/stretchr/testify/assert"
+	"sync"
 	"testing"
+	"time"
 )
 
 type fakeTaskNode struct {
@@ -106,3 +109,97 @@ func Test_Build(t *testing.T) {
 		assert.Equal([]string{"1", "3", "2", "4"}, processOrder)
 	}
 }
+
+func Test_ParallelBuild(t *testing.T) {
+	tasks := []TaskNode{
+		&fakeTaskNode{id: "1", dependencies: []string{}},
+		&fakeTaskNode{id: "2", dependencies: []string{}},
+		&fakeTaskNode{id: "3", dependencies: []string{"1"}},
+		&fakeTaskNode{id: "4", dependencies: []string{"2", "3"}},
+	}
+
+	builder := NewParallelBuildStrategy(tasks, 2)
+
+	var mu sync.Mutex
+	finished := map[string]bool{}
+	started := make(chan string, 4)
+	err := builder.Build(func(name string) error {
+		started <- name
+
+		if name == "1" {
+			// Only completes when 2 is running at the same time
+			select {
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("2 did not run in parallel with 1")
+			case s := <-started:
+				started <- s
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, d := range tasks {
+			if d.GetID() == name {
+				for _, dependency := range d.GetDependencies() {
+					if !finished[dependency] {
+						return fmt.Errorf("%s started before its dependency %s finished", name, dependency)
+					}
+				}
+			}
+		}
+		finished[name] = true
+		return nil
+	})
+
+	assert := assert.New(t)
+	if assert.Nil(err) {
+		assert.Equal(4, len(finished))
+	}
+}
+
+func Test_ParallelBuild_StopsOnFailure(t *testing.T) {
+	tasks := []TaskNode{
+		&fakeTaskNode{id: "1", dependencies: []string{}},
+		&fakeTaskNode{id: "2", dependencies: []string{"1"}},
+		&fakeTaskNode{id: "3", dependencies: []string{"2"}},
+	}
+
+	builder := NewParallelBuildStrategy(tasks, 4)
+
+	processed := []string{}
+	err := builder.Build(func(name string) error {
+		processed = append(processed, name)
+		if name == "2" {
+			return fmt.Errorf("2 failed")
+		}
+		return nil
+	})
+
+	assert := assert.New(t)
+	assert.EqualError(err, "2 failed")
+	assert.Equal([]string{"1", "2"}, processed)
+}
+
+func Test_ParallelBuild_RunsIndependentTasksAfterFailure(t *testing.T) {
+	tasks := []TaskNode{
+		&fakeTaskNode{id: "1", dependencies: []string{}},
+		&fakeTaskNode{id: "2", dependencies: []string{"1"}},
+		&fakeTaskNode{id: "3", dependencies: []string{}},
+		&fakeTaskNode{id: "4", dependencies: []string{"3"}},
+	}
+
+	builder := NewParallelBuildStrategy(tasks, 1)
+
+	processed := []string{}
+	err := builder.Build(func(name string) error {
+		processed = append(processed, name)
+		if name == "1" {
+			return fmt.Errorf("1 failed")
+		}
+		return nil
+	})
+
+	assert := assert.New(t)
+	assert.EqualError(err, "1 failed")
+	assert.Equal([]string{"1", "3", "4"}, processed)
+}
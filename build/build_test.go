@@ -1,11 +1,21 @@
 package build
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/lukesmith/cimple/artifacts"
+	"github.com/lukesmith/cimple/cache"
 	"github.com/lukesmith/cimple/project"
+	"github.com/lukesmith/cimple/redact"
 	"github.com/lukesmith/cimple/vcs"
 )
 
@@ -33,7 +43,7 @@ func Test_buildStepContexts_OrdersContexts(t *testing.T) {
 	var buildConfig = NewBuildConfig("test", os.Stdout, journal, &project, vcs)
 	var logger = log.New(os.Stdout, "test", log.LUTC)
 
-	contexts, err := buildStepContexts(logger, buildConfig, &task)
+	contexts, err := buildStepContexts(logger, buildConfig, &task, nil)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -53,7 +63,7 @@ func Test_buildStepContexts_SkipTask(t *testing.T) {
 	var buildConfig = BuildConfig{}
 	var logger = log.New(os.Stdout, "test", log.LUTC)
 
-	contexts, err := buildStepContexts(logger, &buildConfig, &task)
+	contexts, err := buildStepContexts(logger, &buildConfig, &task, nil)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -63,9 +73,1148 @@ func Test_buildStepContexts_SkipTask(t *testing.T) {
 	}
 }
 
+func Test_runTask_SkipsStepWhenConditionNotMet(t *testing.T) {
+	var task = project.Task{
+		Name: "bob",
+	}
+	task.StepOrder = []string{"fails"}
+	task.Steps = map[string]project.Step{
+		"fails": project.Command{
+			Command: "false",
+			When:    `eq .Vcs.Branch "master"`,
+			Env:     map[string]string{},
+		},
+	}
+
+	cfg := project.Config{
+		Tasks: map[string]*project.Task{"bob": &task},
+	}
+	journal := &recordingJournal{}
+	vcs := vcs.VcsInformation{Branch: "feature"}
+	var buildConfig = NewBuildConfig("test", os.Stdout, journal, &cfg, vcs)
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = build.runTask(build.tasks["bob"])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	found := false
+	for _, r := range journal.records {
+		if s, ok := r.(skipStep); ok && s.Id == "bob.fails" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatalf("Expected skipped step to be recorded in the journal")
+	}
+}
+
+func Test_runTask_StopsServicesWhenStepFails(t *testing.T) {
+	var task = project.Task{
+		Name: "bob",
+		Services: []*project.Service{
+			{Name: "stub", Command: "sleep", Args: []string{"30"}, Export: map[string]string{"STUB": "yes"}},
+		},
+	}
+	task.StepOrder = []string{"fails"}
+	task.Steps = map[string]project.Step{
+		"fails": project.Command{
+			Command: "false",
+			Env:     map[string]string{},
+		},
+	}
+
+	cfg := project.Config{
+		Tasks: map[string]*project.Task{"bob": &task},
+	}
+	journal := &recordingJournal{}
+	var buildConfig = NewBuildConfig("test", ioutil.Discard, journal, &cfg, vcs.VcsInformation{})
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = build.runTask(build.tasks["bob"])
+	if err == nil {
+		t.Fatalf("Expected the task to fail")
+	}
+
+	if build.tasks["bob"].Steps[0].Env.StepEnv["STUB"] != "yes" {
+		t.Fatalf("Expected the service exports to be available to the step")
+	}
+
+	events := []string{}
+	for _, r := range journal.records {
+		switch e := r.(type) {
+		case serviceStarted:
+			events = append(events, "started "+e.Id)
+		case serviceStopped:
+			events = append(events, "stopped "+e.Id)
+		case taskFailed:
+			events = append(events, "failed "+e.Id)
+		}
+	}
+
+	expected := []string{"started bob.stub", "failed bob", "stopped bob.stub"}
+	if fmt.Sprintf("%v", events) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("Expected events %v - was %v", expected, events)
+	}
+}
+
+func Test_runTask_RunsAlwaysStepsAfterAFailure(t *testing.T) {
+	var task = project.Task{
+		Name: "bob",
+	}
+	task.StepOrder = []string{"fails", "skipped", "teardown"}
+	task.Steps = map[string]project.Step{
+		"fails":    project.Command{Command: "false", Env: map[string]string{}},
+		"skipped":  project.Command{Command: "true", Env: map[string]string{}},
+		"teardown": project.Command{Command: "true", Always: true, Env: map[string]string{}},
+	}
+
+	cfg := project.Config{
+		Tasks: map[string]*project.Task{"bob": &task},
+	}
+	journal := &recordingJournal{}
+	var buildConfig = NewBuildConfig("test", ioutil.Discard, journal, &cfg, vcs.VcsInformation{})
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = build.runTask(build.tasks["bob"])
+	if err == nil || err.Error() != "exit status 1" {
+		t.Fatalf("Expected the task to fail with the error of the failed step - was %v", err)
+	}
+
+	events := []string{}
+	for _, r := range journal.records {
+		switch e := r.(type) {
+		case stepFailed:
+			events = append(events, "failed "+e.Id)
+		case skipStep:
+			events = append(events, "skipped "+e.Id)
+		case stepSuccessful:
+			events = append(events, "successful "+e.Id)
+		case taskFailed:
+			events = append(events, "failed "+e.Id)
+		}
+	}
+
+	expected := []string{"failed bob.fails", "skipped bob.skipped", "successful bob.teardown", "failed bob"}
+	if fmt.Sprintf("%v", events) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("Expected events %v - was %v", expected, events)
+	}
+}
+
+func Test_runTask_RecordsAllowedFailures(t *testing.T) {
+	var task = project.Task{
+		Name: "bob",
+	}
+	task.StepOrder = []string{"flaky", "next"}
+	task.Steps = map[string]project.Step{
+		"flaky": project.Command{Command: "false", AllowFailure: true, Env: map[string]string{}},
+		"next":  project.Command{Command: "true", Env: map[string]string{}},
+	}
+
+	cfg := project.Config{
+		Tasks: map[string]*project.Task{"bob": &task},
+	}
+	journal := &recordingJournal{}
+	var buildConfig = NewBuildConfig("test", ioutil.Discard, journal, &cfg, vcs.VcsInformation{})
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := build.runTask(build.tasks["bob"]); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	events := []string{}
+	for _, r := range journal.records {
+		switch e := r.(type) {
+		case stepFailed:
+			events = append(events, "failed "+e.Id)
+		case stepFailureAllowed:
+			events = append(events, "allowed "+e.Id+" - "+e.Reason)
+		case stepSuccessful:
+			events = append(events, "successful "+e.Id)
+		case taskSuccessful:
+			events = append(events, "successful "+e.Id)
+		}
+	}
+
+	expected := []string{"allowed bob.flaky - exit status 1", "successful bob.next", "successful bob"}
+	if fmt.Sprintf("%v", events) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("Expected events %v - was %v", expected, events)
+	}
+}
+
+func Test_Run_RunsFinallyStepsOfStartedTasks(t *testing.T) {
+	cfg, err := project.Load(`
+	name = "test"
+	version = "0.0.1"
+	task test {
+		command fails {
+			command = "false"
+		}
+
+		finally {
+			command collect {
+				command = "true"
+			}
+		}
+	}
+	task package {
+		depends = ["test"]
+
+		command build {
+			command = "true"
+		}
+
+		finally {
+			command clean {
+				command = "true"
+			}
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	journal := &recordingJournal{}
+	var buildConfig = NewBuildConfig("test", ioutil.Discard, journal, cfg, vcs.VcsInformation{})
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = build.Run()
+	if err == nil || err.Error() != "exit status 1" {
+		t.Fatalf("Expected the build to fail with the error of the failed step - was %v", err)
+	}
+
+	events := []string{}
+	for _, r := range journal.records {
+		switch e := r.(type) {
+		case taskFailed:
+			events = append(events, "failed "+e.Id)
+		case stepSuccessful:
+			events = append(events, "successful "+e.Id)
+		}
+	}
+
+	expected := []string{"failed test", "successful test.collect"}
+	if fmt.Sprintf("%v", events) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("Expected events %v - was %v", expected, events)
+	}
+}
+
+func Test_runTask_RestoresAndSavesCaches(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "cache")
+	defer os.RemoveAll(dir)
+	wd := filepath.Join(dir, "wd")
+	os.MkdirAll(filepath.Join(wd, "vendor"), 0755)
+	ioutil.WriteFile(filepath.Join(wd, "vendor", "lib.go"), []byte("package lib"), 0644)
+
+	var task = project.Task{
+		Name: "bob",
+		Caches: []*project.Cache{
+			{Name: "vendor", Key: "{{.TaskName}}-1", Paths: []string{"vendor"}},
+		},
+	}
+	task.StepOrder = []string{"succeeds"}
+	task.Steps = map[string]project.Step{
+		"succeeds": project.Command{
+			Command: "true",
+			Env:     map[string]string{},
+		},
+	}
+
+	cfg := project.Config{
+		Tasks: map[string]*project.Task{"bob": &task},
+	}
+	journal := &recordingJournal{}
+	var buildConfig = NewBuildConfig("test", ioutil.Discard, journal, &cfg, vcs.VcsInformation{})
+	buildConfig.Cache = cache.NewStore(filepath.Join(dir, "store"), 0)
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	build.tasks["bob"].vars.WorkingDir = wd
+
+	for i := 0; i < 2; i++ {
+		if err := build.runTask(build.tasks["bob"]); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	events := []string{}
+	for _, r := range journal.records {
+		switch e := r.(type) {
+		case cacheRestored:
+			events = append(events, fmt.Sprintf("restored %s %s %v", e.Id, e.Key, e.Hit))
+		case cacheSaved:
+			events = append(events, fmt.Sprintf("saved %s %s", e.Id, e.Key))
+		}
+	}
+
+	expected := []string{"restored bob.vendor bob-1 false", "saved bob.vendor bob-1", "restored bob.vendor bob-1 true"}
+	if fmt.Sprintf("%v", events) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("Expected events %v - was %v", expected, events)
+	}
+
+	if d, err := ioutil.ReadFile(filepath.Join(wd, "vendor", "lib.go")); err != nil || string(d) != "package lib" {
+		t.Fatalf("Expected the cache to be restored - %v", err)
+	}
+}
+
+func Test_Run_PassesOutputsToLaterStepsAndDependentTasks(t *testing.T) {
+	cfg, err := project.Load(`
+	name = "test"
+	version = "0.0.1"
+	task package {
+		command version {
+			command = "sh"
+			args = ["-c", "echo label=1.2.3-beta >> $CIMPLE_OUTPUT"]
+		}
+
+		command check {
+			command = "sh"
+			args = ["-c", "test {{.Outputs.package.version.label}} = 1.2.3-beta"]
+		}
+	}
+	task publish {
+		depends = ["package"]
+
+		command check {
+			command = "sh"
+			args = ["-c", "test $LABEL = 1.2.3-beta"]
+			env {
+				LABEL = "{{.Outputs.package.version.label}}"
+			}
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	journal := &recordingJournal{}
+	var buildConfig = NewBuildConfig("test", ioutil.Discard, journal, cfg, vcs.VcsInformation{})
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := build.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, r := range journal.records {
+		if e, ok := r.(stepSuccessful); ok && e.Id == "package.version" {
+			if e.Outputs["label"] != "1.2.3-beta" {
+				t.Fatalf("Expected the outputs to be journaled - was %v", e.Outputs)
+			}
+			return
+		}
+	}
+
+	t.Fatalf("Expected package.version to succeed")
+}
+
+func Test_Run_PassesOutputsOfMatrixVariantsAsEnvironmentVariables(t *testing.T) {
+	cfg, err := project.Load(`
+	name = "test"
+	version = "0.0.1"
+	task test {
+		matrix {
+			go = ["1.8"]
+		}
+
+		command version {
+			command = "sh"
+			args = ["-c", "echo build.label=1.2.3 >> $CIMPLE_OUTPUT"]
+		}
+	}
+	task publish {
+		depends = ["test"]
+
+		command check {
+			command = "sh"
+			args = ["-c", "test \"$CIMPLE_OUTPUT_TEST_GO_1_8__VERSION_BUILD_LABEL\" = 1.2.3"]
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	build, err := NewBuild(NewBuildConfig("test", ioutil.Discard, fakeJournal{}, cfg, vcs.VcsInformation{}))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := build.Run(); err != nil {
+		t.Fatalf("Expected the output of the matrix variant to be available to publish - %s", err)
+	}
+}
+
+func Test_Run_ArchivesMatrixVariantsSeparately(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "archive")
+	defer os.RemoveAll(dir)
+
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	cfg, err := project.Load(`
+	name = "test"
+	version = "0.0.1"
+	task package {
+		matrix {
+			os = ["linux", "darwin"]
+		}
+		archive = ["dist/app.tar.gz"]
+
+		command build {
+			command = "sh"
+			args = ["-c", "mkdir -p dist && printf $CIMPLE_MATRIX_OS > dist/app.tar.gz"]
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	buildConfig := NewBuildConfig("test", ioutil.Discard, fakeJournal{}, cfg, vcs.VcsInformation{})
+	buildConfig.ArtifactsPath = filepath.Join(dir, "artifacts")
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := build.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	manifest, err := artifacts.ReadManifest(buildConfig.ArtifactsPath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(manifest.Artifacts) != 2 {
+		t.Fatalf("Expected an artifact for each variant - was %v", manifest.Artifacts)
+	}
+
+	for _, a := range manifest.Artifacts {
+		d, err := ioutil.ReadFile(filepath.Join(buildConfig.ArtifactsPath, filepath.FromSlash(a.Path)))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		variant := strings.TrimSuffix(strings.TrimPrefix(a.Task, "package[os="), "]")
+		if a.Path != a.Task+"/dist/app.tar.gz" || string(d) != variant {
+			t.Fatalf("Expected the artifact of %s to be stored within its directory - was %s containing %s", a.Task, a.Path, d)
+		}
+	}
+}
+
+func Test_Run_KeepsOnlyTheOutputsOfTheLastAttempt(t *testing.T) {
+	sleep = func(d time.Duration) {}
+	defer func() { sleep = time.Sleep }()
+
+	dir, _ := ioutil.TempDir("", "outputs")
+	defer os.RemoveAll(dir)
+
+	cfg, err := project.Load(fmt.Sprintf(`
+	name = "test"
+	version = "0.0.1"
+	task package {
+		command version {
+			command = "sh"
+			args = ["-c", "echo label=1.2.3 >> $CIMPLE_OUTPUT; test -f %s/attempted || { echo stale=true >> $CIMPLE_OUTPUT; touch %s/attempted; exit 1; }"]
+			retry {
+				attempts = 2
+			}
+		}
+
+		command check {
+			command = "sh"
+			args = ["-c", "test $CIMPLE_OUTPUT_PACKAGE_VERSION_LABEL = 1.2.3"]
+		}
+	}
+	`, dir, dir))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	journal := &recordingJournal{}
+	var buildConfig = NewBuildConfig("test", ioutil.Discard, journal, cfg, vcs.VcsInformation{})
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := build.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, r := range journal.records {
+		if e, ok := r.(stepSuccessful); ok && e.Id == "package.version" {
+			if len(e.Outputs) != 1 || e.Outputs["label"] != "1.2.3" {
+				t.Fatalf("Expected only the outputs of the last attempt - was %v", e.Outputs)
+			}
+			return
+		}
+	}
+
+	t.Fatalf("Expected package.version to succeed")
+}
+
+func Test_Run_RecordsTaskState(t *testing.T) {
+	cfg, err := project.Load(`
+	name = "test"
+	version = "0.0.1"
+	task package {
+		command version {
+			command = "sh"
+			args = ["-c", "echo label=1.2.3 >> $CIMPLE_OUTPUT"]
+		}
+	}
+	task publish {
+		depends = ["package"]
+
+		command upload {
+			command = "false"
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir, _ := ioutil.TempDir("", "build")
+	defer os.RemoveAll(dir)
+
+	var buildConfig = NewBuildConfig("test", ioutil.Discard, fakeJournal{}, cfg, vcs.VcsInformation{})
+	buildConfig.BuildPath = dir
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := build.Run(); err == nil {
+		t.Fatalf("Expected the build to fail")
+	}
+
+	state, err := LoadBuildState(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !state.Succeeded("package") || state.Succeeded("publish") || state.Tasks["publish"].Status != TaskFailed {
+		t.Fatalf("Expected package to succeed and publish to fail - was %v", state.Tasks)
+	}
+
+	if state.Tasks["package"].Outputs["version"]["label"] != "1.2.3" {
+		t.Fatalf("Expected the outputs of package to be recorded - was %v", state.Tasks["package"].Outputs)
+	}
+}
+
+func Test_Run_ResumesFromTheFailedTask(t *testing.T) {
+	cfg, err := project.Load(`
+	name = "test"
+	version = "0.0.1"
+	task package {
+		command version {
+			command = "false"
+		}
+	}
+	task publish {
+		depends = ["package"]
+
+		command check {
+			command = "sh"
+			args = ["-c", "test {{.Outputs.package.version.label}} = 1.2.3"]
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	journal := &recordingJournal{}
+	var buildConfig = NewBuildConfig("test", ioutil.Discard, journal, cfg, vcs.VcsInformation{})
+	buildConfig.Resume = &BuildState{
+		Tasks: map[string]*TaskState{
+			"package": {Status: TaskSucceeded, Outputs: map[string]map[string]string{"version": {"label": "1.2.3"}}},
+			"publish": {Status: TaskFailed, Outputs: map[string]map[string]string{}},
+		},
+	}
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := build.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	events := []string{}
+	for _, r := range journal.records {
+		switch e := r.(type) {
+		case taskSkipped:
+			events = append(events, "skipped "+e.Id)
+		case taskSuccessful:
+			events = append(events, "successful "+e.Id)
+		}
+	}
+
+	expected := []string{"skipped package", "successful publish"}
+	if fmt.Sprintf("%v", events) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("Expected events %v - was %v", expected, events)
+	}
+}
+
+type fakeSecretStore map[string]string
+
+func (s fakeSecretStore) Get(secretType string, key string) (string, error) {
+	return s[secretType+":"+key], nil
+}
+
+func Test_Run_RedactsSecrets(t *testing.T) {
+	os.Setenv("CIMPLE_TEST_SECRET", "hunter2")
+	defer os.Unsetenv("CIMPLE_TEST_SECRET")
+
+	cfg, err := project.Load(`
+	name = "test"
+	version = "0.0.1"
+	task deploy {
+		command login {
+			command = "sh"
+			args = ["-c", "printf 'password hunt'; printf 'er2'; echo; exit 1"]
+			env {
+				PASSWORD = "{{secret \"password\" \"db\"}}"
+			}
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var out bytes.Buffer
+	journal := &recordingJournal{}
+	var buildConfig = NewBuildConfig("test", &out, journal, cfg, vcs.VcsInformation{})
+	buildConfig.Secrets = fakeSecretStore{"password:db": "hunter2"}
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	build.Run()
+
+	if strings.Contains(out.String(), "hunter2") || !strings.Contains(out.String(), "password ****") {
+		t.Fatalf("Expected the secret to be masked in the output - was %s", out.String())
+	}
+
+	redacted := build.redactVars(build.tasks["deploy"].Steps[0].Env)
+	if redacted.HostEnv["CIMPLE_TEST_SECRET"] != redact.Mask {
+		t.Fatalf("Expected the secret to be masked in the journaled vars - was %s", redacted.HostEnv["CIMPLE_TEST_SECRET"])
+	}
+}
+
+func Test_Run_RedactsSecretsInTaskFailures(t *testing.T) {
+	out, err := runWithSecretWorkingDir(t, true)
+	if err == nil || strings.Contains(err.Error(), "hunter2") || !strings.Contains(err.Error(), redact.Mask+" of step login") {
+		t.Fatalf("Expected the build to fail with the secret masked - was %v", err)
+	}
+
+	out, err = runWithSecretWorkingDir(t, false)
+	if err == nil || strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("Expected the build to fail without revealing the secret - was %v", err)
+	}
+
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, "Task deploy[region=us] failed - Working directory ") {
+		t.Fatalf("Expected the secret to be masked in the logged matrix failure - was %s", out)
+	}
+}
+
+// runWithSecretWorkingDir runs a matrix task whose step fails with an error
+// containing a secret, returning the log output and the error of the build.
+func runWithSecretWorkingDir(t *testing.T, failFast bool) (string, error) {
+	cfg, err := project.Load(fmt.Sprintf(`
+	name = "test"
+	version = "0.0.1"
+	task deploy {
+		matrix {
+			region = ["eu", "us"]
+			fail_fast = %t
+		}
+
+		command login {
+			command = "sh"
+			args = ["-c", "true"]
+			working_dir = "{{secret \"password\" \"db\"}}"
+		}
+	}
+	`, failFast))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var out bytes.Buffer
+	var buildConfig = NewBuildConfig("test", &out, fakeJournal{}, cfg, vcs.VcsInformation{})
+	buildConfig.Secrets = fakeSecretStore{"password:db": "hunter2"}
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = build.Run()
+	return out.String(), err
+}
+
+func Test_Run_KeepsSecretStoreCredentialsFromSteps(t *testing.T) {
+	os.Setenv("CIMPLE_SECRETS_KEY", "master-key")
+	defer os.Unsetenv("CIMPLE_SECRETS_KEY")
+	os.Setenv("VAULT_TOKEN", "vault-token")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	cfg, err := project.Load(`
+	name = "test"
+	version = "0.0.1"
+	task deploy {
+		command check {
+			command = "sh"
+			args = ["-c", "test -z \"$CIMPLE_SECRETS_KEY$VAULT_TOKEN\""]
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	journal := &recordingJournal{}
+	var buildConfig = NewBuildConfig("test", ioutil.Discard, journal, cfg, vcs.VcsInformation{})
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := build.Run(); err != nil {
+		t.Fatalf("Expected the credentials to be kept from the step - %s", err)
+	}
+
+	for _, r := range journal.records {
+		if e, ok := r.(stepStarted); ok && (strings.Contains(fmt.Sprintf("%v", e.Env), "master-key") || strings.Contains(fmt.Sprintf("%v", e.Env), "vault-token")) {
+			t.Fatalf("Expected the credentials to be kept from the journal - was %v", e.Env)
+		}
+	}
+}
+
+func Test_executeStep_RetriesFailedAttempts(t *testing.T) {
+	sleep = func(d time.Duration) {}
+	defer func() { sleep = time.Sleep }()
+
+	step := &fakeStep{failures: 2, retry: project.Retry{Attempts: 3, Backoff: "1s"}}
+	journal := &recordingJournal{}
+	build := &Build{
+		config:   &BuildConfig{journal: journal, logWriter: ioutil.Discard},
+		logger:   log.New(ioutil.Discard, "", 0),
+		redactor: redact.New(),
+	}
+
+	err := build.executeStep(&BuildTask{output: ioutil.Discard, logger: build.logger}, StepContext{Id: "task.step", Env: &project.StepVars{}, Step: step})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if step.executions != 3 {
+		t.Fatalf("Expected step to be executed 3 times - was %d", step.executions)
+	}
+
+	failed := []stepAttemptFailed{}
+	for _, r := range journal.records {
+		if f, ok := r.(stepAttemptFailed); ok {
+			failed = append(failed, f)
+		}
+	}
+
+	if len(failed) != 2 || failed[0].Attempt != 1 || failed[1].Attempt != 2 {
+		t.Fatalf("Expected two failed attempts to be recorded - %+v", failed)
+	}
+}
+
+func Test_executeStep_ReturnsLastError(t *testing.T) {
+	sleep = func(d time.Duration) {}
+	defer func() { sleep = time.Sleep }()
+
+	step := &fakeStep{failures: 5, retry: project.Retry{Attempts: 2}}
+	build := &Build{
+		config:   &BuildConfig{journal: fakeJournal{}, logWriter: ioutil.Discard},
+		logger:   log.New(ioutil.Discard, "", 0),
+		redactor: redact.New(),
+	}
+
+	err := build.executeStep(&BuildTask{output: ioutil.Discard, logger: build.logger}, StepContext{Id: "task.step", Env: &project.StepVars{}, Step: step})
+	if err == nil {
+		t.Fatalf("Expected step to fail")
+	}
+
+	if step.executions != 2 {
+		t.Fatalf("Expected step to be executed 2 times - was %d", step.executions)
+	}
+}
+
+type fakeStep struct {
+	failures   int
+	executions int
+	retry      project.Retry
+}
+
+func (s *fakeStep) GetSkip() bool             { return false }
+func (s *fakeStep) GetWhen() string           { return "" }
+func (s *fakeStep) GetName() string           { return "fake" }
+func (s *fakeStep) GetEnv() map[string]string { return map[string]string{} }
+func (s *fakeStep) GetRetry() project.Retry   { return s.retry }
+func (s *fakeStep) GetAlways() bool           { return false }
+func (s *fakeStep) GetAllowFailure() bool     { return false }
+func (s *fakeStep) Execute(vars project.StepVars, stdout io.Writer, stderr io.Writer) error {
+	s.executions = s.executions + 1
+	if s.executions <= s.failures {
+		return fmt.Errorf("attempt %d failed", s.executions)
+	}
+	return nil
+}
+
 type fakeJournal struct {
 }
 
 func (f fakeJournal) Record(record interface{}) error {
 	return nil
 }
+
+type recordingJournal struct {
+	records []interface{}
+}
+
+func (j *recordingJournal) Record(record interface{}) error {
+	j.records = append(j.records, record)
+	return nil
+}
+
+func Test_isSelected(t *testing.T) {
+	task := &BuildTask{
+		Name:     "test[go=1.8,goos=linux]",
+		baseName: "test",
+		matrix:   map[string]string{"go": "1.8", "goos": "linux"},
+	}
+
+	if !isSelected([]string{"test"}, task) {
+		t.Fatalf("Expected matrix variant to be selected by its task name")
+	}
+
+	if !isSelected([]string{"test[go=1.8]"}, task) {
+		t.Fatalf("Expected matrix variant to be selected by a partial selector")
+	}
+
+	if !isSelected([]string{"test[go=1.8,goos=linux]"}, task) {
+		t.Fatalf("Expected matrix variant to be selected by its full name")
+	}
+
+	if isSelected([]string{"test[go=1.7]"}, task) {
+		t.Fatalf("Expected matrix variant not to be selected by a different axis value")
+	}
+
+	if isSelected([]string{"other"}, &BuildTask{Name: "test"}) {
+		t.Fatalf("Expected task not to be selected")
+	}
+}
+
+func Test_NewBuild_ValidatesParams(t *testing.T) {
+	def := "linux"
+	cfg := &project.Config{
+		Tasks: map[string]*project.Task{
+			"package": {
+				Name: "package",
+				Params: map[string]*project.Param{
+					"os":      {Name: "os", Type: project.ParamTypeChoice, Choices: []string{"linux", "darwin"}, Default: &def},
+					"release": {Name: "release", Type: project.ParamTypeBool},
+				},
+			},
+		},
+	}
+
+	buildConfig := NewBuildConfig("test", ioutil.Discard, fakeJournal{}, cfg, vcs.VcsInformation{})
+	buildConfig.Params = map[string]map[string]string{
+		"package": {"os": "windows"},
+		"deploy":  {"env": "prod"},
+	}
+
+	_, err := NewBuild(buildConfig)
+	if ce, ok := err.(*project.ConfigError); ok {
+		expected := []string{
+			"Param package.os is invalid - windows is not one of linux, darwin",
+			"Param package.release must be supplied",
+			"Params were supplied for unknown task deploy",
+		}
+		if fmt.Sprintf("%v", ce.Issues) != fmt.Sprintf("%v", expected) {
+			t.Fatalf("Expected issues %v - was %v", expected, ce.Issues)
+		}
+	} else {
+		t.Fatalf("Expected a ConfigError - was %v", err)
+	}
+
+	buildConfig.Params = map[string]map[string]string{
+		"package": {"release": "yes"},
+	}
+	_, err = NewBuild(buildConfig)
+	if err == nil {
+		t.Fatalf("Expected yes to be rejected as a bool")
+	}
+
+	buildConfig.Params = map[string]map[string]string{
+		"package": {"release": "1"},
+	}
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	vars := build.tasks["package"].vars.Map()
+	if vars["CIMPLE_PARAM_RELEASE"] != "true" || vars["CIMPLE_PARAM_OS"] != "linux" {
+		t.Fatalf("Expected params to be resolved - was %v", vars)
+	}
+}
+
+func Test_NewBuild_OnlyRequiresParamsForSelectedTasks(t *testing.T) {
+	cfg := &project.Config{
+		Tasks: map[string]*project.Task{
+			"package": {
+				Name: "package",
+				Params: map[string]*project.Param{
+					"release": {Name: "release", Type: project.ParamTypeBool},
+				},
+			},
+			"test": {Name: "test"},
+		},
+	}
+
+	buildConfig := NewBuildConfig("test", ioutil.Discard, fakeJournal{}, cfg, vcs.VcsInformation{})
+	buildConfig.ExplicitTasks = []string{"test"}
+
+	if _, err := NewBuild(buildConfig); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func Test_NewBuild_OnlyRequiresParamsForTasksWhichRun(t *testing.T) {
+	cfg := &project.Config{
+		Tasks: map[string]*project.Task{
+			"package": {
+				Name: "package",
+				Skip: true,
+				Params: map[string]*project.Param{
+					"release": {Name: "release", Type: project.ParamTypeBool},
+				},
+			},
+		},
+	}
+
+	if _, err := NewBuild(NewBuildConfig("test", ioutil.Discard, fakeJournal{}, cfg, vcs.VcsInformation{})); err != nil {
+		t.Fatalf("Expected the params of a skipped task to not be required - %s", err)
+	}
+
+	buildConfig := NewBuildConfig("test", ioutil.Discard, fakeJournal{}, cfg, vcs.VcsInformation{})
+	buildConfig.ExplicitTasks = []string{"package"}
+
+	if _, err := NewBuild(buildConfig); err == nil || !strings.Contains(err.Error(), "Param package.release must be supplied") {
+		t.Fatalf("Expected the params of a selected skipped task to be required - was %v", err)
+	}
+}
+
+func Test_Run_OnlyRequiresParamsOnceTheConditionIsMet(t *testing.T) {
+	for _, tc := range []struct {
+		when string
+		err  string
+	}{
+		{when: "false"},
+		{when: "true", err: "Param package.release must be supplied"},
+	} {
+		cfg, err := project.Load(fmt.Sprintf(`
+		name = "test"
+		version = "0.0.1"
+		task package {
+			when = "%s"
+			param release {
+				type = "bool"
+			}
+
+			command build {
+				command = "true"
+			}
+		}
+		`, tc.when))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		build, err := NewBuild(NewBuildConfig("test", ioutil.Discard, fakeJournal{}, cfg, vcs.VcsInformation{}))
+		if err != nil {
+			t.Fatalf("Expected the params of a conditional task to not be required up front - %s", err)
+		}
+
+		err = build.Run()
+		if len(tc.err) == 0 && err != nil {
+			t.Fatalf("Expected the build to succeed when %s - %s", tc.when, err)
+		} else if len(tc.err) != 0 && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Fatalf("Expected %s when %s - was %v", tc.err, tc.when, err)
+		}
+	}
+}
+
+func Test_Run_ParallelPrefixesTaskOutput(t *testing.T) {
+	cfg, err := project.Load(`
+	name = "test"
+	version = "0.0.1"
+	task fix {
+		command greet {
+			command = "sh"
+			args = ["-c", "echo hello from fix"]
+		}
+	}
+	task test {
+		command greet {
+			command = "sh"
+			args = ["-c", "printf 'hello from test'"]
+		}
+	}
+	task publish {
+		depends = ["fix", "test"]
+
+		command greet {
+			command = "sh"
+			args = ["-c", "echo hello from publish"]
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var output bytes.Buffer
+	buildConfig := NewBuildConfig("test", &output, &recordingJournal{}, cfg, vcs.VcsInformation{})
+	buildConfig.Parallel = 2
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := build.Run(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, line := range []string{"[fix] hello from fix\n", "[test] hello from test\n", "[publish] hello from publish\n"} {
+		if !strings.Contains(output.String(), line) {
+			t.Fatalf("Expected output to contain %q - was %s", line, output.String())
+		}
+	}
+}
+
+func Test_Run_ParallelSkipsDependentsOfFailedTask(t *testing.T) {
+	cfg, err := project.Load(`
+	name = "test"
+	version = "0.0.1"
+	task fix {
+		command fail {
+			command = "sh"
+			args = ["-c", "exit 1"]
+		}
+	}
+	task test {
+		command greet {
+			command = "sh"
+			args = ["-c", "sleep 0.2; echo hello from test"]
+		}
+	}
+	task publish {
+		depends = ["fix"]
+
+		command greet {
+			command = "sh"
+			args = ["-c", "echo hello from publish"]
+		}
+	}
+	task release {
+		depends = ["publish"]
+
+		command greet {
+			command = "sh"
+			args = ["-c", "echo hello from release"]
+		}
+	}
+	`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	journal := &recordingJournal{}
+	buildConfig := NewBuildConfig("test", ioutil.Discard, journal, cfg, vcs.VcsInformation{})
+	buildConfig.Parallel = 2
+
+	build, err := NewBuild(buildConfig)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := build.Run(); err == nil {
+		t.Fatalf("Expected the build to fail")
+	}
+
+	skipped := map[string]string{}
+	tested := false
+	for _, r := range journal.records {
+		switch e := r.(type) {
+		case taskStarted:
+			if e.Id == "publish" || e.Id == "release" {
+				t.Fatalf("Expected %s not to run", e.Id)
+			}
+		case taskSkipped:
+			skipped[e.Id] = e.Reason
+		case taskSuccessful:
+			tested = tested || e.Id == "test"
+		}
+	}
+
+	if !tested {
+		t.Fatalf("Expected test to run as it does not depend on fix")
+	}
+
+	if skipped["publish"] != "Dependency fix failed" || skipped["release"] != "Dependency publish failed" {
+		t.Fatalf("Expected the dependents of fix to be skipped - was %v", skipped)
+	}
+}
@@ -1,6 +1,7 @@
 package build
 
 import (
+	"github.com/lukesmith/cimple/cache"
 	"github.com/lukesmith/cimple/journal"
 	"github.com/lukesmith/cimple/project"
 	"github.com/lukesmith/cimple/vcs"
@@ -12,11 +13,26 @@ type BuildConfig struct {
 	ExplicitTasks []string
 	Secrets       project.SecretStore
 	RunContext    string
-	logWriter     io.Writer
-	journal       journal.Journal
-	project       project.Project
-	tasks         map[string]*project.Task
-	repoInfo      vcs.VcsInformation
+	ArtifactsPath string
+	// BuildPath is the directory holding the files created during the build.
+	BuildPath string
+	// Params are the values supplied for task params, keyed by task name.
+	Params map[string]map[string]string
+	// DryRunPublish lists the files publish steps would publish rather than
+	// publishing them.
+	DryRunPublish bool
+	// Parallel is the number of tasks which may run at the same time.
+	Parallel int
+	// Resume is the state of the build being resumed. Tasks which succeeded
+	// are not run again, their outputs and artifacts are reused.
+	Resume *BuildState
+	// Cache stores the task caches between builds. Caching is disabled when nil.
+	Cache     *cache.Store
+	logWriter io.Writer
+	journal   journal.Journal
+	project   project.Project
+	tasks     map[string]*project.Task
+	repoInfo  vcs.VcsInformation
 }
 
 func NewBuildConfig(buildId string, logWriter io.Writer, journal journal.Journal, cfg *project.Config, ri vcs.VcsInformation) *BuildConfig {
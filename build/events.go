@@ -1,6 +1,7 @@
 package build
 
 import (
+	"github.com/lukesmith/cimple/artifacts"
 	"github.com/lukesmith/cimple/project"
 	"github.com/lukesmith/cimple/vcs"
 )
@@ -12,16 +13,36 @@ type stepStarted struct {
 	Step     interface{}
 }
 
+type stepAttemptStarted struct {
+	Id      string
+	Attempt int
+}
+
+type stepAttemptFailed struct {
+	Id      string
+	Attempt int
+	Reason  string
+}
+
 type stepSuccessful struct {
-	Id string
+	Id      string
+	Outputs map[string]string
 }
 
 type stepFailed struct {
 	Id string
 }
 
+// stepFailureAllowed is recorded in place of stepFailed when a step which is
+// allowed to fail fails.
+type stepFailureAllowed struct {
+	Id     string
+	Reason string
+}
+
 type skipStep struct {
-	Id string
+	Id     string
+	Reason string
 }
 
 type taskStarted struct {
@@ -42,6 +63,35 @@ type taskSuccessful struct {
 	Id string
 }
 
+type taskArchived struct {
+	Id        string
+	Artifacts []artifacts.Artifact
+}
+
+type serviceStarted struct {
+	Id string
+}
+
+type serviceFailed struct {
+	Id     string
+	Reason string
+}
+
+type serviceStopped struct {
+	Id string
+}
+
+type cacheRestored struct {
+	Id  string
+	Key string
+	Hit bool
+}
+
+type cacheSaved struct {
+	Id  string
+	Key string
+}
+
 type buildStarted struct {
 	Repo vcs.VcsInformation
 }
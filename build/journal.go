@@ -0,0 +1,20 @@
+package build
+
+import (
+	"sync"
+
+	"github.com/lukesmith/cimple/journal"
+)
+
+// syncJournal serialises records so the journal can be shared by tasks
+// running in parallel.
+type syncJournal struct {
+	mu      sync.Mutex
+	journal journal.Journal
+}
+
+func (j *syncJournal) Record(record interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.journal.Record(record)
+}
@@ -0,0 +1,43 @@
+package build
+
+import (
+	"github.com/lukesmith/cimple/env"
+	"github.com/lukesmith/cimple/project"
+	"github.com/lukesmith/cimple/redact"
+)
+
+// credentialVariables hold the credentials used to open the secret stores.
+// They are kept out of the environment of steps and the journal.
+var credentialVariables = []string{
+	"CIMPLE_SECRETS_KEY",
+	"CIMPLE_SECRETS_KEY_FILE",
+	"VAULT_TOKEN",
+	"VAULT_ROLE_ID",
+	"VAULT_SECRET_ID",
+}
+
+// hostEnv returns the environment variables of the host other than credentials.
+func hostEnv() map[string]string {
+	vars := env.EnvironmentVariables()
+	for _, k := range credentialVariables {
+		delete(vars, k)
+	}
+	return vars
+}
+
+// redactingSecretStore registers each secret retrieved with the redactor so
+// it is masked within the output and journal of the build.
+type redactingSecretStore struct {
+	store    project.SecretStore
+	redactor *redact.Redactor
+}
+
+func (s *redactingSecretStore) Get(secretType string, key string) (string, error) {
+	value, err := s.store.Get(secretType, key)
+	if err != nil {
+		return "", err
+	}
+
+	s.redactor.Add(value)
+	return value, nil
+}
@@ -0,0 +1,80 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/lukesmith/cimple/artifacts"
+)
+
+// StateFile is the file within the build path recording the outcome of each task.
+const StateFile = "state.json"
+
+const (
+	TaskSucceeded = "successful"
+	TaskFailed    = "failed"
+)
+
+// BuildState records the outcome of each task of a build, allowing a failed
+// build to be resumed without running the tasks which succeeded again.
+type BuildState struct {
+	Tasks map[string]*TaskState
+}
+
+// TaskState is the outcome of a task along with the outputs of its steps and
+// the artifacts it archived.
+type TaskState struct {
+	Status    string
+	Outputs   map[string]map[string]string
+	Artifacts []artifacts.Artifact
+}
+
+func newBuildState() *BuildState {
+	return &BuildState{Tasks: make(map[string]*TaskState)}
+}
+
+// LoadBuildState reads the state recorded for the build in buildPath.
+func LoadBuildState(buildPath string) (*BuildState, error) {
+	data, err := ioutil.ReadFile(filepath.Join(buildPath, StateFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("No state was recorded for the build in %s", buildPath)
+	} else if err != nil {
+		return nil, err
+	}
+
+	state := newBuildState()
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("Unable to read the state of the build in %s - %s", buildPath, err)
+	}
+
+	return state, nil
+}
+
+// Succeeded reports whether the task succeeded.
+func (s *BuildState) Succeeded(task string) bool {
+	state, ok := s.Tasks[task]
+	return ok && state.Status == TaskSucceeded
+}
+
+// write replaces the state file in buildPath, so an interrupted write never
+// leaves a partial file behind.
+func (s *BuildState) write(buildPath string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(buildPath, 0755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(buildPath, StateFile)
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,329 @@
+package cache
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	entryExtension = ".tar.gz"
+
+	// DefaultMaxSize is the size the cache is allowed to grow to before the
+	// least recently used entries are evicted.
+	DefaultMaxSize int64 = 2 * 1024 * 1024 * 1024
+)
+
+// Store holds cached directories as archives within a directory. Entries are
+// addressed by the name of the cache and its key, so an entry is never
+// changed once saved.
+type Store struct {
+	dir     string
+	maxSize int64
+}
+
+// NewStore creates a store within dir. A maxSize of zero or less disables
+// eviction.
+func NewStore(dir string, maxSize int64) *Store {
+	return &Store{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+}
+
+func (s *Store) entryPath(name string, key string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s-%x%s", name, sha256.Sum256([]byte(key)), entryExtension))
+}
+
+// Restore replaces the paths within workingDir with those saved for the key,
+// returning false when there is no entry for the key.
+func (s *Store) Restore(name string, key string, paths []string, workingDir string) (bool, error) {
+	entry := s.entryPath(name, key)
+
+	f, err := os.Open(entry)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	for _, p := range paths {
+		if err := os.RemoveAll(filepath.Join(workingDir, p)); err != nil {
+			return false, err
+		}
+	}
+
+	if err := extract(f, workingDir); err != nil {
+		return false, err
+	}
+
+	// Entries are evicted by their modification time, so mark it as used.
+	now := time.Now()
+	if err := os.Chtimes(entry, now, now); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Save archives the paths within workingDir for the key, returning false when
+// an entry already exists. Paths which do not exist are ignored.
+func (s *Store) Save(name string, key string, paths []string, workingDir string) (bool, error) {
+	entry := s.entryPath(name, key)
+	if _, err := os.Stat(entry); err == nil {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return false, err
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, name)
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = archive(tmp, paths, workingDir)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.Rename(tmp.Name(), entry); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Evict removes the least recently used entries until the store is within
+// its maximum size.
+func (s *Store) Evict() ([]string, error) {
+	evicted := []string{}
+	if s.maxSize <= 0 {
+		return evicted, nil
+	}
+
+	infos, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return evicted, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := []os.FileInfo{}
+	var size int64
+	for _, info := range infos {
+		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), entryExtension) {
+			entries = append(entries, info)
+			size += info.Size()
+		}
+	}
+
+	sort.Sort(byModTime(entries))
+
+	for _, info := range entries {
+		if size <= s.maxSize {
+			break
+		}
+
+		if err := os.Remove(filepath.Join(s.dir, info.Name())); err != nil {
+			return evicted, err
+		}
+		size -= info.Size()
+		evicted = append(evicted, info.Name())
+	}
+
+	return evicted, nil
+}
+
+func archive(w io.Writer, paths []string, workingDir string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	for _, p := range paths {
+		root := filepath.Join(workingDir, p)
+		if _, err := os.Lstat(root); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(workingDir, path)
+			if err != nil {
+				return err
+			}
+
+			link := ""
+			if info.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(path); err != nil {
+					return err
+				}
+			} else if !info.IsDir() && !info.Mode().IsRegular() {
+				return nil
+			}
+
+			header, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(rel)
+
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+func extract(r io.Reader, workingDir string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if outside(name) {
+			return fmt.Errorf("Cache entry %s is outside of the working directory", header.Name)
+		}
+		target := filepath.Join(workingDir, name)
+
+		if err := checkEntry(header, name, workingDir); err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		// Replace rather than write through an existing symlink
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkEntry fails when an entry would be written through a symlink, or is a
+// symlink pointing outside of the working directory, as either would allow a
+// cache to write files elsewhere on the host.
+func checkEntry(header *tar.Header, name string, workingDir string) error {
+	dir := workingDir
+	for _, part := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Cache entry %s is within the symlink %s", header.Name, dir)
+		}
+	}
+
+	if header.Typeflag != tar.TypeSymlink {
+		return nil
+	}
+
+	link := filepath.FromSlash(header.Linkname)
+	if filepath.IsAbs(link) {
+		rel, err := filepath.Rel(workingDir, link)
+		if err != nil || outside(rel) {
+			return fmt.Errorf("Cache entry %s links to %s outside of the working directory", header.Name, header.Linkname)
+		}
+	} else if outside(filepath.Join(filepath.Dir(name), link)) {
+		return fmt.Errorf("Cache entry %s links to %s outside of the working directory", header.Name, header.Linkname)
+	}
+
+	return nil
+}
+
+// outside determines whether a path relative to the working directory refers
+// to a location outside of it.
+func outside(rel string) bool {
+	return filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+type byModTime []os.FileInfo
+
+func (f byModTime) Len() int           { return len(f) }
+func (f byModTime) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f byModTime) Less(i, j int) bool { return f[i].ModTime().Before(f[j].ModTime()) }
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_SaveAndRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "cache")
+	defer os.RemoveAll(dir)
+	wd, _ := ioutil.TempDir("", "wd")
+	defer os.RemoveAll(wd)
+
+	os.MkdirAll(filepath.Join(wd, "vendor", "github.com", "lib"), 0755)
+	ioutil.WriteFile(filepath.Join(wd, "vendor", "github.com", "lib", "lib.go"), []byte("package lib"), 0644)
+
+	store := NewStore(filepath.Join(dir, "store"), 0)
+
+	restored, err := store.Restore("vendor", "abc", []string{"vendor"}, wd)
+	assert.Nil(err)
+	assert.False(restored)
+
+	saved, err := store.Save("vendor", "abc", []string{"vendor", "missing"}, wd)
+	assert.Nil(err)
+	assert.True(saved)
+
+	saved, err = store.Save("vendor", "abc", []string{"vendor"}, wd)
+	assert.Nil(err)
+	assert.False(saved)
+
+	os.RemoveAll(filepath.Join(wd, "vendor"))
+	os.MkdirAll(filepath.Join(wd, "vendor"), 0755)
+	ioutil.WriteFile(filepath.Join(wd, "vendor", "stale.go"), []byte("stale"), 0644)
+
+	restored, err = store.Restore("vendor", "abc", []string{"vendor"}, wd)
+	if assert.Nil(err) && assert.True(restored) {
+		d, err := ioutil.ReadFile(filepath.Join(wd, "vendor", "github.com", "lib", "lib.go"))
+		if assert.Nil(err) {
+			assert.Equal("package lib", string(d))
+		}
+
+		_, err = os.Stat(filepath.Join(wd, "vendor", "stale.go"))
+		assert.True(os.IsNotExist(err))
+	}
+
+	restored, err = store.Restore("vendor", "def", []string{"vendor"}, wd)
+	assert.Nil(err)
+	assert.False(restored)
+}
+
+func TestStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "cache")
+	defer os.RemoveAll(dir)
+
+	write := func(name string, size int, age time.Duration) {
+		path := filepath.Join(dir, name+entryExtension)
+		ioutil.WriteFile(path, make([]byte, size), 0644)
+		modified := time.Now().Add(-age)
+		os.Chtimes(path, modified, modified)
+	}
+
+	write("oldest", 10, 3*time.Hour)
+	write("older", 10, 2*time.Hour)
+	write("newest", 10, time.Hour)
+	ioutil.WriteFile(filepath.Join(dir, "other"), make([]byte, 100), 0644)
+
+	store := NewStore(dir, 15)
+	evicted, err := store.Evict()
+	if assert.Nil(err) {
+		assert.Equal([]string{"oldest" + entryExtension, "older" + entryExtension}, evicted)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "newest"+entryExtension))
+	assert.Nil(err)
+}
+
+func TestExtract_RejectsEntriesOutsideTheWorkingDirectory(t *testing.T) {
+	for _, entries := range [][]*tar.Header{
+		{
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "OUTSIDE"},
+			{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		},
+		{
+			{Name: "vendor/link", Typeflag: tar.TypeSymlink, Linkname: "../../OUTSIDE"},
+		},
+		{
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "OUTSIDE/evil"},
+		},
+		{
+			{Name: "existing/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+		},
+	} {
+		outsideDir, _ := ioutil.TempDir("", "outside")
+		defer os.RemoveAll(outsideDir)
+		wd, _ := ioutil.TempDir("", "wd")
+		defer os.RemoveAll(wd)
+		os.Symlink(outsideDir, filepath.Join(wd, "existing"))
+
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		for _, h := range entries {
+			h.Linkname = strings.Replace(h.Linkname, "OUTSIDE", outsideDir, 1)
+			tw.WriteHeader(h)
+			if h.Size != 0 {
+				tw.Write([]byte("evil"))
+			}
+		}
+		tw.Close()
+		gw.Close()
+
+		err := extract(&buf, wd)
+		assert.NotNil(t, err, entries[len(entries)-1].Name)
+
+		files, _ := ioutil.ReadDir(outsideDir)
+		assert.Empty(t, files)
+	}
+}
@@ -1,5 +1,5 @@
 cimple {
-  version = "0.0.4"
+  version = "0.0.5"
 }
 
 name = "Cimple"
@@ -32,6 +32,11 @@ Runs the Cimple tests.
 Prior to running the tests dependencies are installed.
 DESC
 
+  cache vendor {
+    key = "{{sha256file \"glide.lock\"}}"
+    paths = ["vendor"]
+  }
+
   command glide {
     command = "glide"
     args = ["install"]
@@ -60,38 +65,59 @@ goxc -build-ldflags \
 BODY
   }
 
-  script build-alpine-binary {
+  container build-alpine-binary {
+    image = "golang:1.7.4-alpine"
+    working_dir = "/go/src/github.com/lukesmith/cimple"
+
+    env {
+      # The host go installation is not available within the image.
+      GOPATH = "/go"
+      GOROOT = "/usr/local/go"
+      PATH = "/usr/local/go/bin:/go/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+    }
+
     body = <<BODY
-docker run -u `id -u $USER` --rm -v "$PWD":/go/src/github.com/lukesmith/cimple -w /go/src/github.com/lukesmith/cimple golang:1.7.4-alpine go build -v \
+go build -v \
   -ldflags="-X main.VERSION={{index .Project.Version}} -X main.BuildDate={{index .FormattedBuildDate}} -X main.Revision={{index .Vcs.Revision}}" \
   -o output/cimple-alpine
 BODY
   }
 
-  script build-cimple-docker {
+  script build-cimple-docker-branch {
+    when = "ne .Vcs.Branch \"master\""
     body = <<SCRIPT
-{{ if ne (index .Vcs.Branch) "master" }}
 docker build --build-arg CIMPLE_VERSION={{index .Project.Version}}-$VERSION_LABEL -t cimple -f Dockerfile .
-{{ else }}
+
+# Create a ruby agent image
+docker build -t cimple-ruby-agent -f Dockerfile.ruby-agent .
+SCRIPT
+  }
+
+  script build-cimple-docker {
+    when = "eq .Vcs.Branch \"master\""
+    body = <<SCRIPT
 docker build --build-arg CIMPLE_VERSION={{index .Project.Version}} -t cimple -f Dockerfile .
-{{ end }}
 
 # Create a ruby agent image
 docker build -t cimple-ruby-agent -f Dockerfile.ruby-agent .
 SCRIPT
   }
 
-  script tag-cimple-docker {
+  script tag-cimple-docker-branch {
+    when = "ne .Vcs.Branch \"master\""
     body = <<SCRIPT
-{{ if ne (index .Vcs.Branch) "master" }}
 docker tag cimple cimpleci/cimple:{{index .Project.Version}}-$VERSION_LABEL
 docker tag cimple-ruby-agent cimpleci/cimple-ruby-agent:{{index .Project.Version}}-$VERSION_LABEL
-{{ else }}
+SCRIPT
+  }
+
+  script tag-cimple-docker {
+    when = "eq .Vcs.Branch \"master\""
+    body = <<SCRIPT
 docker tag cimple cimpleci/cimple:latest
 docker tag cimpleci/cimple:latest cimpleci/cimple:{{index .Project.Version}}
 docker tag cimple-ruby-agent cimpleci/cimple-ruby-agent:latest
 docker tag cimpleci/cimple-ruby-agent:latest cimpleci/cimple-ruby-agent:{{index .Project.Version}}
-{{ end }}
 SCRIPT
   }
 }
@@ -100,17 +126,21 @@ task publish {
   depends = ["package"]
   limit_to = "server"
 
-  script publish-cimple-docker {
+  script publish-cimple-docker-branch {
+    when = "ne .Vcs.Branch \"master\""
     body = <<SCRIPT
-{{ if ne (index .Vcs.Branch) "master" }}
 docker push cimpleci/cimple:{{index .Project.Version}}-$VERSION_LABEL
 docker push cimpleci/cimple-ruby-agent:{{index .Project.Version}}-$VERSION_LABEL
-{{ else }}
+SCRIPT
+  }
+
+  script publish-cimple-docker {
+    when = "eq .Vcs.Branch \"master\""
+    body = <<SCRIPT
 docker push cimpleci/cimple:latest
 docker push cimpleci/cimple:{{index .Project.Version}}
 docker push cimpleci/cimple-ruby-agent:latest
 docker push cimpleci/cimple-ruby-agent:{{index .Project.Version}}
-{{ end }}
 SCRIPT
   }
 
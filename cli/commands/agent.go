@@ -13,6 +13,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 func Agent() cli.Command {
@@ -47,14 +48,36 @@ func Agent() cli.Command {
 				Name:  "tag",
 				Usage: "Specify tags for the agent",
 			},
+			cli.StringFlag{
+				Name:  "cache-dir",
+				Usage: "The directory task caches are kept in between builds. Defaults to the user cache directory",
+			},
+			cli.StringFlag{
+				Name:  "secrets-file",
+				Usage: "An encrypted secrets file, as managed by `cimple secrets`, to make available to builds",
+			},
+			cli.StringFlag{
+				Name:   "secrets-key-file",
+				Usage:  "A file containing the key of the secrets file. The CIMPLE_SECRETS_KEY environment variable can be used instead",
+				EnvVar: "CIMPLE_SECRETS_KEY_FILE",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			logging.SetDefaultLogger("Agent", os.Stdout)
 
 			agentConfig, err := agent.DefaultConfig()
+			if err != nil {
+				return err
+			}
 			agentConfig.ServerAddr = c.String("server-addr")
 			agentConfig.ServerPort = c.String("server-port")
 			agentConfig.EnableTLS = !c.Bool("no-tls")
+			if dir := c.String("cache-dir"); len(dir) != 0 {
+				agentConfig.CacheDir = dir
+			}
+			if err := setAgentSecrets(agentConfig, c.String("secrets-file"), c.String("secrets-key-file")); err != nil {
+				return err
+			}
 
 			if agentConfig.EnableTLS == true {
 				caFile := c.String("tls-ca-file")
@@ -102,6 +125,28 @@ func Agent() cli.Command {
 	}
 }
 
+// setAgentSecrets makes the secrets file paths absolute as builds are run
+// within a clone of the repository.
+func setAgentSecrets(config *agent.Config, file string, keyFile string) error {
+	if len(file) != 0 {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		config.SecretsFile = abs
+	}
+
+	if len(keyFile) != 0 {
+		abs, err := filepath.Abs(keyFile)
+		if err != nil {
+			return err
+		}
+		config.SecretsKeyFile = abs
+	}
+
+	return nil
+}
+
 func createTLSConfig(caFile string, skipVerify bool) (*tls.Config, error) {
 	CA_Pool := x509.NewCertPool()
 	if len(caFile) != 0 {
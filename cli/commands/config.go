@@ -3,6 +3,7 @@ package cli
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/gyuho/goraph"
@@ -29,6 +30,74 @@ func Config() cli.Command {
 				Value: "graphviz",
 			},
 		},
+		Subcommands: []cli.Command{
+			{
+				Name:  "lint",
+				Usage: "Reports every problem within the config",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "configuration",
+						Usage: "specify the CONFIGURATION file to lint",
+						Value: "cimple.hcl",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					configFile := c.String("configuration")
+					issues, err := project.Lint(configFile)
+					if err != nil {
+						return cli.NewExitError(fmt.Sprintf("Unable to lint configuration file - %s - %s", configFile, err), CONFIGURATION_ERROR_CODE)
+					}
+
+					for _, issue := range issues {
+						fmt.Println(issue)
+					}
+
+					if len(issues) != 0 {
+						return cli.NewExitError(fmt.Sprintf("%d issues found", len(issues)), CONFIGURATION_ERROR_CODE)
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:  "migrate",
+				Usage: "Rewrites the config to the current schema version",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "configuration",
+						Usage: "specify the CONFIGURATION file to migrate",
+						Value: "cimple.hcl",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					configFile := c.String("configuration")
+					d, err := ioutil.ReadFile(configFile)
+					if err != nil {
+						return cli.NewExitError(fmt.Sprintf("Unable to read configuration file - %s - %s", configFile, err), CONFIGURATION_ERROR_CODE)
+					}
+
+					migrated, changes, err := project.Migrate(string(d))
+					if err != nil {
+						return cli.NewExitError(fmt.Sprintf("Unable to migrate configuration file - %s - %s", configFile, err), CONFIGURATION_ERROR_CODE)
+					}
+
+					if len(changes) == 0 {
+						fmt.Printf("%s already uses schema version %s\n", configFile, project.SchemaVersion)
+						return nil
+					}
+
+					if err := ioutil.WriteFile(configFile, migrated, 0644); err != nil {
+						return cli.NewExitError(fmt.Sprintf("Unable to write configuration file - %s - %s", configFile, err), CONFIGURATION_ERROR_CODE)
+					}
+
+					for _, change := range changes {
+						fmt.Println(change)
+					}
+
+					return nil
+				},
+			},
+		},
 		Action: func(c *cli.Context) error {
 			configFile := c.String("configuration")
 			cfg, err := project.LoadConfig(configFile)
@@ -66,7 +135,7 @@ func writeGraphViz(g goraph.Graph) (string, error) {
 	a := build.Entrypoints(g)
 
 	for _, ep := range a {
-		writer.Write([]byte(fmt.Sprintf("\t%s", ep.ID())))
+		writer.Write([]byte(fmt.Sprintf("\t%q", ep.ID().String())))
 
 		err := traverse(g, ep, writer, written)
 		if err != nil {
@@ -88,7 +157,7 @@ func traverse(g goraph.Graph, node goraph.Node, writer *bytes.Buffer, written ma
 	}
 
 	for _, tg := range targets {
-		writer.Write([]byte(fmt.Sprintf(" -> %s", tg.ID())))
+		writer.Write([]byte(fmt.Sprintf(" -> %q", tg.ID().String())))
 		if _, ok := written[tg.String()]; !ok {
 			written[tg.String()] = true
 			err := traverse(g, tg, writer, written)
@@ -2,6 +2,8 @@ package cli
 
 import (
 	"fmt"
+	"github.com/lukesmith/cimple/cache"
+	"github.com/lukesmith/cimple/project"
 	"github.com/lukesmith/cimple/runner"
 	"github.com/urfave/cli"
 	"strings"
@@ -12,10 +14,10 @@ func Run() cli.Command {
 		Name:    "run",
 		Aliases: []string{"r"},
 		Usage:   "Run Cimple against the current directory",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			cli.StringSliceFlag{
 				Name:  "task",
-				Usage: "a specific `TASK` to run. Note that if the task is set to `skip` it will be run.",
+				Usage: "a specific `TASK` to run. Note that if the task is set to `skip` it will be run. Matrix variants can be selected with `name[axis=value]`",
 			},
 			cli.StringFlag{
 				Name:  "journal-driver",
@@ -32,24 +34,92 @@ func Run() cli.Command {
 				Usage: "specify the `CONTEXT` in which to execute the run in. Available options \"local\", \"server\"",
 				Value: "local",
 			},
+			cli.StringFlag{
+				Name:  "build-id",
+				Usage: "specify the `ID` of the build. Defaults to the current time in nanoseconds",
+			},
+			cli.StringSliceFlag{
+				Name:  "param",
+				Usage: "specifies the value of a task `PARAM` in the format `task.name=value`",
+			},
 			cli.StringSliceFlag{
 				Name:  "secret",
 				Usage: "specifies a `SECRET` to make available to the tasks. Secrets must be defined in the format `type:key:password`",
 			},
-		},
+			cli.StringFlag{
+				Name:  "secrets-file",
+				Usage: "specifies an encrypted secrets `FILE` to make available to the tasks, as managed by `cimple secrets`",
+			},
+			cli.StringFlag{
+				Name:  "cache-dir",
+				Usage: "specify the `DIR` task caches are stored in. Defaults to .cimple/.cache",
+			},
+			cli.IntFlag{
+				Name:  "cache-size",
+				Usage: "specify the `MB` task caches may use before the least recently used are evicted",
+				Value: int(cache.DefaultMaxSize / (1024 * 1024)),
+			},
+			cli.IntFlag{
+				Name:  "parallel",
+				Usage: "run up to `N` tasks at the same time, prefixing the output of each task with its name",
+				Value: 1,
+			},
+			cli.StringFlag{
+				Name:  "resume",
+				Usage: "resume the build with `ID`, skipping the tasks which succeeded and reusing their outputs",
+			},
+			cli.BoolFlag{
+				Name:  "resume-last",
+				Usage: "resume the most recent build, skipping the tasks which succeeded and reusing their outputs",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run-publish",
+				Usage: "list the files publish steps would publish, and where to, without publishing them",
+			},
+		}, append(secretsKeyFlags(), vaultFlags()...)...),
 		Action: func(c *cli.Context) error {
 			ss, err := makeCliSecretStore(c.StringSlice("secret"))
 			if err != nil {
 				return err
 			}
 
+			stores := chainedSecretStore{ss}
+			if file := c.String("secrets-file"); len(file) != 0 {
+				fs, err := openSecretsFile(c, file)
+				if err != nil {
+					return err
+				}
+				stores = append(stores, fs)
+			}
+
+			vault, err := openVault(c)
+			if err != nil {
+				return err
+			}
+			if vault != nil {
+				stores = append(stores, vault)
+			}
+
+			params, err := project.ParseParamArgs(c.StringSlice("param"))
+			if err != nil {
+				return err
+			}
+
 			runOptions := &runner.RunOptions{
 				Journal: &runner.JournalSettings{
 					Driver: c.String("journal-driver"),
 					Format: c.String("journal-format"),
 				},
-				Context: c.String("run-context"),
-				Secrets: ss,
+				Context:       c.String("run-context"),
+				Secrets:       stores,
+				BuildId:       c.String("build-id"),
+				Params:        params,
+				CacheDir:      c.String("cache-dir"),
+				CacheSize:     int64(c.Int("cache-size")) * 1024 * 1024,
+				DryRunPublish: c.Bool("dry-run-publish"),
+				Parallel:      c.Int("parallel"),
+				Resume:        c.String("resume"),
+				ResumeLast:    c.Bool("resume-last"),
 			}
 
 			return runner.Run(runOptions, c.StringSlice("task"))
@@ -62,7 +132,7 @@ func makeCliSecretStore(vals []string) (*cliSecretStore, error) {
 	ss.secrets = make(map[string]map[string]string)
 
 	for _, s := range vals {
-		parts := strings.Split(s, ":")
+		parts := strings.SplitN(s, ":", 3)
 
 		if len(parts) != 3 {
 			return nil, fmt.Errorf("Secret defined without 3 parts. Ensure the secret is in the format `type:key:password`")
@@ -17,7 +17,7 @@ func TestRun_Settings(t *testing.T) {
 func Test_makeCliSecretStore(t *testing.T) {
 	assert := assert.New(t)
 
-	values := []string{"type:key:password", "type:key2:p2", "type2:key3:p3"}
+	values := []string{"type:key:password", "type:key2:p2", "type2:key3:p:3"}
 	store, err := makeCliSecretStore(values)
 
 	if assert.Nil(err) {
@@ -33,7 +33,7 @@ func Test_makeCliSecretStore(t *testing.T) {
 
 		p, err = store.Get("type2", "key3")
 		if assert.Nil(err) {
-			assert.Equal("p3", p)
+			assert.Equal("p:3", p)
 		}
 	}
 }
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lukesmith/cimple/project"
+	"github.com/lukesmith/cimple/secrets"
+	"github.com/urfave/cli"
+)
+
+const defaultSecretsFile = ".cimple/.secrets"
+
+func secretsKeyFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "secrets-key",
+			Usage:  "the `KEY` the secrets file is encrypted with. Prefer the environment variable so the key is kept out of shell history",
+			EnvVar: "CIMPLE_SECRETS_KEY",
+		},
+		cli.StringFlag{
+			Name:   "secrets-key-file",
+			Usage:  "a `FILE` containing the key the secrets file is encrypted with",
+			EnvVar: "CIMPLE_SECRETS_KEY_FILE",
+		},
+	}
+}
+
+func vaultFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "vault-addr",
+			Usage:  "the `ADDRESS` of a vault server to retrieve secrets from",
+			EnvVar: "VAULT_ADDR",
+		},
+		cli.StringFlag{
+			Name:   "vault-token",
+			Usage:  "the `TOKEN` used to authenticate with vault",
+			EnvVar: "VAULT_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "vault-role-id",
+			Usage:  "the AppRole `ID` used to authenticate with vault",
+			EnvVar: "VAULT_ROLE_ID",
+		},
+		cli.StringFlag{
+			Name:   "vault-secret-id",
+			Usage:  "the AppRole secret `ID` used to authenticate with vault",
+			EnvVar: "VAULT_SECRET_ID",
+		},
+		cli.StringFlag{
+			Name:   "vault-mount",
+			Usage:  "the `PATH` the vault KV secrets engine is mounted at",
+			Value:  "secret",
+			EnvVar: "CIMPLE_VAULT_MOUNT",
+		},
+		cli.IntFlag{
+			Name:   "vault-kv-version",
+			Usage:  "the `VERSION` of the vault KV secrets engine, 1 or 2",
+			Value:  2,
+			EnvVar: "CIMPLE_VAULT_KV_VERSION",
+		},
+		cli.StringFlag{
+			Name:   "vault-field",
+			Usage:  "the `FIELD` of a vault secret holding its value",
+			Value:  "value",
+			EnvVar: "CIMPLE_VAULT_FIELD",
+		},
+	}
+}
+
+// openVault creates a vault secret store when a vault address is given.
+func openVault(c *cli.Context) (*secrets.VaultStore, error) {
+	if len(c.String("vault-addr")) == 0 {
+		return nil, nil
+	}
+
+	return secrets.NewVaultStore(secrets.VaultConfig{
+		Address:   c.String("vault-addr"),
+		Mount:     c.String("vault-mount"),
+		KVVersion: c.Int("vault-kv-version"),
+		Field:     c.String("vault-field"),
+		Token:     c.String("vault-token"),
+		RoleId:    c.String("vault-role-id"),
+		SecretId:  c.String("vault-secret-id"),
+	})
+}
+
+func openSecretsFile(c *cli.Context, path string) (*secrets.FileStore, error) {
+	key, err := secrets.ReadKey(c.String("secrets-key"), c.String("secrets-key-file"))
+	if err != nil {
+		return nil, err
+	}
+
+	return secrets.OpenFileStore(path, key)
+}
+
+func Secrets() cli.Command {
+	flags := append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "secrets-file",
+			Usage: "the encrypted secrets `FILE` to manage",
+			Value: defaultSecretsFile,
+		},
+	}, secretsKeyFlags()...)
+
+	withStore := func(args int, action func(c *cli.Context, store *secrets.FileStore) error) func(c *cli.Context) error {
+		return func(c *cli.Context) error {
+			if c.NArg() != args {
+				return cli.NewExitError(fmt.Sprintf("Expected %d arguments - usage: %s", args, c.Command.ArgsUsage), 1)
+			}
+
+			store, err := openSecretsFile(c, c.String("secrets-file"))
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+
+			return action(c, store)
+		}
+	}
+
+	return cli.Command{
+		Name:  "secrets",
+		Usage: "Manage an encrypted secrets file",
+		Subcommands: []cli.Command{
+			{
+				Name:      "set",
+				Usage:     "Sets a secret, reading the value from stdin",
+				ArgsUsage: "TYPE KEY",
+				Flags:     flags,
+				Action: withStore(2, func(c *cli.Context, store *secrets.FileStore) error {
+					fmt.Fprintf(os.Stderr, "Enter the %s %s: ", c.Args().Get(0), c.Args().Get(1))
+					value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+					value = strings.TrimRight(value, "\r\n")
+					if len(value) == 0 {
+						return cli.NewExitError(fmt.Sprintf("No value was given - %v", err), 1)
+					}
+
+					store.Set(c.Args().Get(0), c.Args().Get(1), value)
+					return store.Save()
+				}),
+			},
+			{
+				Name:      "get",
+				Usage:     "Prints the value of a secret",
+				ArgsUsage: "TYPE KEY",
+				Flags:     flags,
+				Action: withStore(2, func(c *cli.Context, store *secrets.FileStore) error {
+					value, err := store.Get(c.Args().Get(0), c.Args().Get(1))
+					if err != nil {
+						return cli.NewExitError(err.Error(), 1)
+					}
+
+					fmt.Println(value)
+					return nil
+				}),
+			},
+			{
+				Name:  "list",
+				Usage: "Lists the type and key of each secret",
+				Flags: flags,
+				Action: withStore(0, func(c *cli.Context, store *secrets.FileStore) error {
+					for _, e := range store.List() {
+						fmt.Printf("%s %s\n", e.Type, e.Key)
+					}
+					return nil
+				}),
+			},
+			{
+				Name:      "rm",
+				Usage:     "Removes a secret",
+				ArgsUsage: "TYPE KEY",
+				Flags:     flags,
+				Action: withStore(2, func(c *cli.Context, store *secrets.FileStore) error {
+					if err := store.Remove(c.Args().Get(0), c.Args().Get(1)); err != nil {
+						return cli.NewExitError(err.Error(), 1)
+					}
+					return store.Save()
+				}),
+			},
+		},
+	}
+}
+
+// chainedSecretStore retrieves a secret from the first store containing it.
+type chainedSecretStore []project.SecretStore
+
+func (stores chainedSecretStore) Get(secretType string, key string) (string, error) {
+	var err error
+	for _, s := range stores {
+		var value string
+		if value, err = s.Get(secretType, key); err == nil {
+			return value, nil
+		}
+	}
+
+	return "", err
+}
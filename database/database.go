@@ -2,10 +2,15 @@ package database
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/lukesmith/cimple/artifacts"
 )
 
 type CimpleDatabase interface {
@@ -13,6 +18,8 @@ type CimpleDatabase interface {
 	GetProject(name string) (*Project, error)
 	GetBuilds(project string) ([]*Build, error)
 	GetBuild(project string, id string) (*Build, error)
+	FindBuild(id string) (*Build, error)
+	SaveArtifact(project string, id string, path string, r io.Reader) error
 }
 
 type database struct {
@@ -20,12 +27,12 @@ type database struct {
 }
 
 func (db *database) GetProjects() []*Project {
-	dirs, _ := filepath.Glob(filepath.Join(db.path, "*"))
+	dirs := subdirectories(db.path)
 
 	projects := []*Project{}
 
 	for _, d := range dirs {
-		builds, _ := filepath.Glob(filepath.Join(d, "*"))
+		builds := subdirectories(d)
 		projects = append(projects, &Project{
 			Name:       filepath.Base(d),
 			BuildCount: len(builds),
@@ -46,7 +53,7 @@ func (db *database) GetProject(name string) (*Project, error) {
 }
 
 func (db *database) GetBuilds(project string) ([]*Build, error) {
-	dirs, _ := filepath.Glob(filepath.Join(db.path, project, "*"))
+	dirs := subdirectories(filepath.Join(db.path, project))
 
 	builds := []*Build{}
 
@@ -57,9 +64,11 @@ func (db *database) GetBuilds(project string) ([]*Build, error) {
 		}
 
 		builds = append(builds, &Build{
-			Id:         filepath.Base(d),
-			Date:       t,
-			outputPath: filepath.Join(d, "output"),
+			Id:            filepath.Base(d),
+			Project:       project,
+			Date:          t,
+			outputPath:    filepath.Join(d, "output"),
+			artifactsPath: filepath.Join(d, "artifacts"),
 		})
 	}
 
@@ -81,6 +90,41 @@ func (db *database) GetBuild(project string, id string) (*Build, error) {
 	return nil, fmt.Errorf("Unable to find build %s for project %s", id, project)
 }
 
+func (db *database) FindBuild(id string) (*Build, error) {
+	for _, p := range db.GetProjects() {
+		build, err := db.GetBuild(p.Name, id)
+		if err == nil {
+			return build, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Unable to find build %s", id)
+}
+
+func (db *database) SaveArtifact(project string, id string, path string, r io.Reader) error {
+	if !artifacts.ValidPath(project) || !artifacts.ValidPath(id) || !artifacts.ValidPath(path) {
+		return fmt.Errorf("Invalid artifact %s for build %s of project %s", path, id, project)
+	}
+
+	if _, err := db.GetBuild(project, id); err != nil {
+		return err
+	}
+
+	target := filepath.Join(db.path, project, id, "artifacts", filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
 func NewDatabase(path string) CimpleDatabase {
 	return &database{
 		path: path,
@@ -93,15 +137,44 @@ type Project struct {
 }
 
 type Build struct {
-	Id         string
-	Date       time.Time
-	outputPath string
+	Id            string
+	Project       string
+	Date          time.Time
+	outputPath    string
+	artifactsPath string
 }
 
 func (b *Build) GetOutput() ([]byte, error) {
 	return ioutil.ReadFile(b.outputPath)
 }
 
+func (b *Build) GetArtifacts() (*artifacts.Manifest, error) {
+	return artifacts.ReadManifest(b.artifactsPath)
+}
+
+func (b *Build) ArtifactPath(path string) (string, error) {
+	if !artifacts.ValidPath(path) {
+		return "", fmt.Errorf("Invalid artifact %s", path)
+	}
+
+	return filepath.Join(b.artifactsPath, filepath.FromSlash(path)), nil
+}
+
+// subdirectories returns the directories within path, skipping hidden ones
+// such as .cache which hold the data of cimple itself rather than builds.
+func subdirectories(path string) []string {
+	infos, _ := ioutil.ReadDir(path)
+
+	dirs := []string{}
+	for _, info := range infos {
+		if info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+			dirs = append(dirs, filepath.Join(path, info.Name()))
+		}
+	}
+
+	return dirs
+}
+
 func msToTime(ms string) (time.Time, error) {
 	msInt, err := strconv.ParseInt(ms, 10, 64)
 	if err != nil {
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProjects_SkipsCimpleDirectories(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "cimple")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "cimple", "1234", "artifacts"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".cache", "go"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".includes", "abc"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, ".secrets"), []byte("secrets"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "cimple", "1234.tmp"), []byte("partial"), 0644)
+
+	db := NewDatabase(dir)
+
+	projects := db.GetProjects()
+	if assert.Equal(1, len(projects)) {
+		assert.Equal("cimple", projects[0].Name)
+		assert.Equal(1, projects[0].BuildCount)
+	}
+
+	builds, err := db.GetBuilds("cimple")
+	if assert.Nil(err) && assert.Equal(1, len(builds)) {
+		assert.Equal("1234", builds[0].Id)
+	}
+}
@@ -1,9 +1,11 @@
 package logging
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
+	"sync"
 )
 
 func SetDefaultLogger(prefix string, out io.Writer) {
@@ -15,3 +17,72 @@ func SetDefaultLogger(prefix string, out io.Writer) {
 func CreateLogger(prefix string, out io.Writer) *log.Logger {
 	return log.New(out, fmt.Sprintf("%-10s: ", prefix), log.Ldate|log.Ltime|log.Lmicroseconds|log.LUTC)
 }
+
+// SyncWriter serialises writes to out so it can be shared between goroutines.
+type SyncWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewSyncWriter(out io.Writer) *SyncWriter {
+	return &SyncWriter{out: out}
+}
+
+func (w *SyncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Write(p)
+}
+
+// PrefixWriter prefixes each line written to out, writing only whole lines so
+// the output of concurrent writers stays readable. Flush writes any remaining
+// partial line.
+type PrefixWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	prefix []byte
+	line   []byte
+}
+
+func NewPrefixWriter(out io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{out: out, prefix: []byte(prefix)}
+}
+
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.line = append(w.line, p...)
+	var lines []byte
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, w.prefix...)
+		lines = append(lines, w.line[:i+1]...)
+		w.line = w.line[i+1:]
+	}
+
+	if len(lines) != 0 {
+		if _, err := w.out.Write(lines); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (w *PrefixWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.line) == 0 {
+		return nil
+	}
+
+	line := append(append([]byte{}, w.prefix...), w.line...)
+	w.line = nil
+	_, err := w.out.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,22 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := NewPrefixWriter(&out, "[test] ")
+
+	w.Write([]byte("one\ntw"))
+	if out.String() != "[test] one\n" {
+		t.Fatalf("Expected only whole lines to be written - was %q", out.String())
+	}
+
+	w.Write([]byte("o\nthree"))
+	w.Flush()
+	if out.String() != "[test] one\n[test] two\n[test] three\n" {
+		t.Fatalf("Expected each line to be prefixed - was %q", out.String())
+	}
+}
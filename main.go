@@ -30,6 +30,7 @@ func main() {
 		cimpleCli.Config(),
 		cimpleCli.Agents(),
 		cimpleCli.Builds(),
+		cimpleCli.Secrets(),
 	}
 
 	app.Run(os.Args)
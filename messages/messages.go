@@ -30,6 +30,8 @@ type RegisterAgentMessage struct {
 type BuildGitRepository struct {
 	Url    string
 	Commit string
+	// Params are the values of task params in the form task.name.
+	Params map[string]string
 }
 
 type BuildComplete struct {
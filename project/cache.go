@@ -0,0 +1,96 @@
+package project
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Cache is a set of directories restored before the steps of a task are run
+// and saved once the task has succeeded.
+type Cache struct {
+	Name string
+	// Key identifies the contents of the cache, e.g. the checksum of a lock
+	// file. A cache is only restored when its key matches.
+	Key   string
+	Paths []string
+}
+
+func parseCaches(list *ast.ObjectList) ([]*Cache, error) {
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+
+	caches := []*Cache{}
+	names := make(map[string]bool)
+
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			return nil, &ConfigError{
+				Issues: []string{"A cache must have a name"},
+			}
+		}
+
+		var m map[string]interface{}
+		if err := hcl.DecodeObject(&m, item.Val); err != nil {
+			return nil, err
+		}
+
+		cache := &Cache{
+			Name: item.Keys[0].Token.Value().(string),
+		}
+		if err := mapstructure.WeakDecode(m, cache); err != nil {
+			return nil, err
+		}
+
+		if names[cache.Name] {
+			return nil, &ConfigError{
+				Issues: []string{fmt.Sprintf("A cache named %s exists multiple times", cache.Name)},
+			}
+		}
+		names[cache.Name] = true
+
+		if len(cache.Key) == 0 {
+			return nil, &ConfigError{
+				Issues: []string{fmt.Sprintf("Cache %s must specify a key", cache.Name)},
+			}
+		}
+
+		if len(cache.Paths) == 0 {
+			return nil, &ConfigError{
+				Issues: []string{fmt.Sprintf("Cache %s must specify the paths to cache", cache.Name)},
+			}
+		}
+
+		for _, p := range cache.Paths {
+			clean := filepath.Clean(p)
+			if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+				return nil, &ConfigError{
+					Issues: []string{fmt.Sprintf("Cache %s path %s must be within the working directory", cache.Name, p)},
+				}
+			}
+		}
+
+		caches = append(caches, cache)
+	}
+
+	return caches, nil
+}
+
+// RenderKey renders the key of the cache using the task variables.
+func (c *Cache) RenderKey(vars StepVars) (string, error) {
+	key, err := renderTemplate(fmt.Sprintf("%s.key", c.Name), c.Key, vars)
+	if err != nil {
+		return "", err
+	}
+
+	if len(strings.TrimSpace(key)) == 0 {
+		return "", fmt.Errorf("The key of cache %s is empty", c.Name)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,73 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCaches(t *testing.T) {
+	assert := assert.New(t)
+
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+	task test {
+		cache vendor {
+			key = "{{sha256file \"glide.lock\"}}"
+			paths = ["vendor"]
+		}
+	}
+	`
+
+	cfg, err := Load(testconfig)
+	if !assert.Nil(err) {
+		return
+	}
+
+	caches := cfg.Tasks["test"].Caches
+	if assert.Len(caches, 1) {
+		assert.Equal("vendor", caches[0].Name)
+		assert.Equal("{{sha256file \"glide.lock\"}}", caches[0].Key)
+		assert.Equal([]string{"vendor"}, caches[0].Paths)
+	}
+}
+
+func TestParseCaches_PathsMustBeWithinTheWorkingDirectory(t *testing.T) {
+	for _, p := range []string{"/var/cache", "../vendor", "."} {
+		testconfig := `
+		name = "test"
+		version = "0.0.1"
+		task test {
+			cache vendor {
+				key = "abc"
+				paths = ["` + p + `"]
+			}
+		}
+		`
+
+		_, err := Load(testconfig)
+		assert.IsType(t, &ConfigError{}, err, p)
+	}
+}
+
+func TestCache_RenderKey(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "cache")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "glide.lock"), []byte("hello"), 0644)
+
+	c := &Cache{Name: "vendor", Key: "{{.TaskName}}-{{sha256file \"glide.lock\"}}"}
+	key, err := c.RenderKey(StepVars{TaskName: "test", WorkingDir: dir})
+	if assert.Nil(err) {
+		assert.Equal("test-2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", key)
+	}
+
+	c.Key = "{{if false}}x{{end}} "
+	_, err = c.RenderKey(StepVars{})
+	assert.NotNil(err)
+}
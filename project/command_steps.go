@@ -1,14 +1,12 @@
 package project
 
 import (
-	"bytes"
+	"fmt"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
 	"github.com/mitchellh/mapstructure"
 	"io"
-	"log"
 	exec "os/exec"
-	"text/template"
 )
 
 type CommandStepParser struct {
@@ -18,6 +16,10 @@ func (st CommandStepParser) GetToken() string {
 	return "command"
 }
 
+func (st CommandStepParser) GetAttributes() []string {
+	return []string{"command", "args", "working_dir", "env", "skip", "when", "always", "allow_failure", "timeout", "retry"}
+}
+
 func (st CommandStepParser) Parse(item *ast.ObjectItem) (Step, error) {
 	var m map[string]interface{}
 	if err := hcl.DecodeObject(&m, item.Val); err != nil {
@@ -25,12 +27,12 @@ func (st CommandStepParser) Parse(item *ast.ObjectItem) (Step, error) {
 	}
 
 	delete(m, "env")
+	delete(m, "retry")
 
 	name := item.Keys[0].Token.Value().(string)
 	var c Command
 	c.Env = make(map[string]string)
 	if err := mapstructure.WeakDecode(m, &c); err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 
@@ -45,15 +47,31 @@ func (st CommandStepParser) Parse(item *ast.ObjectItem) (Step, error) {
 		return nil, err
 	}
 
+	if _, err := parseTimeout(c.Timeout); err != nil {
+		return nil, err
+	}
+
+	retry, err := parseRetry(listVal.Filter("retry"))
+	if err != nil {
+		return nil, err
+	}
+	c.Retry = retry
+
 	return c, nil
 }
 
 type Command struct {
-	name    string
-	Command string
-	Args    []string
-	Env     map[string]string
-	Skip    bool
+	name         string
+	Command      string
+	Args         []string
+	WorkingDir   string `mapstructure:"working_dir"`
+	Env          map[string]string
+	Skip         bool
+	When         string
+	Timeout      string
+	Retry        Retry
+	Always       bool
+	AllowFailure bool `mapstructure:"allow_failure"`
 }
 
 func (c Command) GetName() string {
@@ -64,10 +82,26 @@ func (c Command) GetSkip() bool {
 	return c.Skip
 }
 
+func (c Command) GetWhen() string {
+	return c.When
+}
+
 func (c Command) GetEnv() map[string]string {
 	return c.Env
 }
 
+func (c Command) GetRetry() Retry {
+	return c.Retry
+}
+
+func (c Command) GetAlways() bool {
+	return c.Always
+}
+
+func (c Command) GetAllowFailure() bool {
+	return c.AllowFailure
+}
+
 func (c Command) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) error {
 	args, err := c.templateArgs(vars)
 	if err != nil {
@@ -76,6 +110,12 @@ func (c Command) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) erro
 
 	var cmd = exec.Command(c.Command, args...)
 
+	dir, err := stepWorkingDir(c.name, c.WorkingDir, vars)
+	if err != nil {
+		return err
+	}
+	cmd.Dir = dir
+
 	// Clear out env for command so not to inherit current process's environment.
 	cmd.Env = []string{}
 
@@ -91,7 +131,12 @@ func (c Command) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) erro
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
-	err = cmd.Run()
+	timeout, err := parseTimeout(c.Timeout)
+	if err != nil {
+		return err
+	}
+
+	err = runProcess(cmd, timeout, vars.Cancel)
 	if err != nil {
 		return err
 	}
@@ -101,31 +146,17 @@ func (c Command) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) erro
 
 func (c Command) templateArgs(vars StepVars) ([]string, error) {
 	args := []string{}
-	for _, v := range c.Args {
-		tmpl, err := template.New("t").Parse(v)
+	for i, v := range c.Args {
+		arg, err := renderTemplate(fmt.Sprintf("%s.args[%d]", c.name, i), v, vars)
 		if err != nil {
 			return nil, err
 		}
-		var doc bytes.Buffer
-		tmpl.Execute(&doc, vars)
-		args = append(args, doc.String())
+		args = append(args, arg)
 	}
 
 	return args, nil
 }
 
 func (c Command) templatedEnvs(vars StepVars) (map[string]string, error) {
-	env := make(map[string]string)
-
-	for k, v := range vars.Map() {
-		tmpl, err := template.New("t").Parse(v)
-		if err != nil {
-			return nil, err
-		}
-		var doc bytes.Buffer
-		tmpl.Execute(&doc, vars)
-		env[k] = doc.String()
-	}
-
-	return env, nil
+	return renderEnvs(c.name, vars.Map(), vars)
 }
@@ -0,0 +1,102 @@
+package project
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lukesmith/cimple/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandStepParser_TimeoutAndRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	commandHcl := `
+command example {
+	command = "glide"
+	args = ["install"]
+	timeout = "10m"
+	retry {
+		attempts = 3
+		backoff = "5s"
+	}
+}
+`
+	item, err := extractStep(commandHcl, "command")
+	if assert.Nil(err) {
+		parser := &CommandStepParser{}
+		step, err := parser.Parse(item)
+		if assert.Nil(err) {
+			command := step.(Command)
+			assert.Equal("10m", command.Timeout)
+			assert.Equal(3, command.GetRetry().GetAttempts())
+			assert.Equal(5*time.Second, command.GetRetry().GetBackoff(1))
+			assert.Equal(10*time.Second, command.GetRetry().GetBackoff(2))
+		}
+	}
+}
+
+func TestCommandStepParser_InvalidTimeout(t *testing.T) {
+	commandHcl := `
+command example {
+	command = "glide"
+	timeout = "soon"
+}
+`
+	item, err := extractStep(commandHcl, "command")
+	if assert.Nil(t, err) {
+		parser := &CommandStepParser{}
+		_, err := parser.Parse(item)
+		assert.IsType(t, &ConfigError{}, err)
+	}
+}
+
+func TestCommand_Execute_Timeout(t *testing.T) {
+	assert := assert.New(t)
+
+	command := Command{
+		Command: "sleep",
+		Args:    []string{"5"},
+		Env:     map[string]string{},
+		Timeout: "100ms",
+	}
+
+	vars := StepVars{Cimple: &env.CimpleEnvironment{}}
+	var out bytes.Buffer
+	start := time.Now()
+	err := command.Execute(vars, &out, &out)
+
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "Timed out")
+	}
+	assert.True(time.Since(start) < 5*time.Second)
+}
+
+func TestCommand_Execute_WorkingDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "command")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "cow.txt"), []byte("moo"), 0644)
+
+	command := Command{
+		name:       "cat",
+		Command:    "cat",
+		Args:       []string{"cow.txt"},
+		WorkingDir: filepath.Base(dir),
+		Env:        map[string]string{},
+	}
+
+	vars := StepVars{Cimple: &env.CimpleEnvironment{}, WorkingDir: filepath.Dir(dir)}
+	var out bytes.Buffer
+	err = command.Execute(vars, &out, &out)
+
+	if assert.Nil(t, err) {
+		assert.Equal(t, "moo", out.String())
+	}
+}
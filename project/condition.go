@@ -0,0 +1,45 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EvaluateCondition evaluates a when expression against the step variables.
+// The expression is a go template pipeline, e.g. eq .Vcs.Branch "master",
+// which must produce a boolean.
+func EvaluateCondition(expr string, vars StepVars) (bool, error) {
+	if len(strings.TrimSpace(expr)) == 0 {
+		return true, nil
+	}
+
+	expr = conditionTemplate(expr)
+
+	tmpl, err := parseTemplate("when", expr, vars)
+	if err != nil {
+		return false, fmt.Errorf("Unable to parse condition %s - %s", expr, err)
+	}
+
+	var doc bytes.Buffer
+	if err := tmpl.Execute(&doc, vars); err != nil {
+		return false, fmt.Errorf("Unable to evaluate condition %s - %s", expr, err)
+	}
+
+	result, err := strconv.ParseBool(strings.TrimSpace(doc.String()))
+	if err != nil {
+		return false, fmt.Errorf("Condition %s must evaluate to true or false - was %s", expr, doc.String())
+	}
+
+	return result, nil
+}
+
+// conditionTemplate wraps a bare pipeline so it can be parsed as a template.
+func conditionTemplate(expr string) string {
+	if !strings.Contains(expr, "{{") {
+		return fmt.Sprintf("{{ %s }}", expr)
+	}
+
+	return expr
+}
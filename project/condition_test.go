@@ -0,0 +1,46 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/lukesmith/cimple/vcs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	assert := assert.New(t)
+
+	vars := StepVars{
+		RunContext: "server",
+		Vcs: vcs.VcsInformation{
+			Branch: "master",
+		},
+	}
+
+	met, err := EvaluateCondition(`eq .Vcs.Branch "master"`, vars)
+	if assert.Nil(err) {
+		assert.True(met)
+	}
+
+	met, err = EvaluateCondition(`and (eq .RunContext "server") (ne .Vcs.Tag "")`, vars)
+	if assert.Nil(err) {
+		assert.False(met)
+	}
+
+	met, err = EvaluateCondition(`{{ ne .Vcs.Branch "master" }}`, vars)
+	if assert.Nil(err) {
+		assert.False(met)
+	}
+}
+
+func TestEvaluateCondition_Empty(t *testing.T) {
+	met, err := EvaluateCondition("", StepVars{})
+	if assert.Nil(t, err) {
+		assert.True(t, met)
+	}
+}
+
+func TestEvaluateCondition_NotBoolean(t *testing.T) {
+	_, err := EvaluateCondition(".Vcs.Branch", StepVars{})
+	assert.NotNil(t, err)
+}
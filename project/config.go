@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"path/filepath"
 
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
@@ -22,6 +22,8 @@ type SecretStore interface {
 
 type StepParser interface {
 	GetToken() string
+	// GetAttributes returns the attributes and blocks a step may contain.
+	GetAttributes() []string
 	Parse(*ast.ObjectItem) (Step, error)
 }
 
@@ -35,6 +37,19 @@ type Task struct {
 	Env         map[string]string
 	Skip        bool
 	LimitTo     string
+	When        string
+	Override    bool
+	Params      map[string]*Param
+	Services    []*Service
+	Caches      []*Cache
+	// BaseName is the name of the task block a matrix variant was expanded from.
+	BaseName string
+	Matrix   map[string]string
+	FailFast bool
+	// Finally are steps run once the build completes, whatever its outcome,
+	// when the task has started.
+	Finally      map[string]Step
+	FinallyOrder []string
 }
 
 func (t Task) GetID() string {
@@ -51,16 +66,46 @@ type StepVars struct {
 	Project    Project
 	Vcs        vcs.VcsInformation
 	TaskName   string
+	Matrix     map[string]string
+	Params     map[string]string
+	RunContext string
 	WorkingDir string
-	HostEnv    map[string]string
-	StepEnv    map[string]string
-	Secrets    SecretStore
+	// BuildDir is the directory within .cimple holding the files of the build.
+	BuildDir string
+	HostEnv  map[string]string
+	StepEnv  map[string]string
+	Secrets  SecretStore
+	// Outputs are those written by earlier steps of the task and by the
+	// tasks it depends on.
+	Outputs Outputs
+	// OutputFile is the file the step writes its outputs to.
+	OutputFile string
+	// DryRunPublish lists the files publish steps would publish rather than
+	// publishing them.
+	DryRunPublish bool
+	// Cancel is closed when the step should stop, e.g. when a step running
+	// alongside it in a parallel step fails.
+	Cancel <-chan struct{} `json:"-"`
 }
 
 func (sv StepVars) FormattedBuildDate() string {
 	return sv.BuildDate.Format(time.RFC3339)
 }
 
+// outputVariable is the name of the environment variable holding an output,
+// e.g. CIMPLE_OUTPUT_PACKAGE_BUILD_BINARY_LABEL. Characters which are not
+// valid within a variable name, such as those of a matrix variant name like
+// test[go=1.8], are replaced by _.
+func outputVariable(task string, step string, key string) string {
+	name := strings.ToUpper(strings.Join([]string{"CIMPLE_OUTPUT", task, step, key}, "_"))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
 func (sv *StepVars) Map() map[string]string {
 	m := make(map[string]string)
 	m = merge(m, sv.HostEnv)
@@ -70,12 +115,34 @@ func (sv *StepVars) Map() map[string]string {
 	m["CIMPLE_PROJECT_NAME"] = sv.Project.Name
 	m["CIMPLE_PROJECT_VERSION"] = sv.Project.Version
 	m["CIMPLE_TASK_NAME"] = sv.TaskName
+	m["CIMPLE_RUN_CONTEXT"] = sv.RunContext
 	m["CIMPLE_WORKING_DIR"] = sv.WorkingDir
 	m["CIMPLE_VCS"] = sv.Vcs.Vcs
 	m["CIMPLE_VCS_BRANCH"] = sv.Vcs.Branch
 	m["CIMPLE_VCS_REVISION"] = sv.Vcs.Revision
 	m["CIMPLE_VCS_REMOTE_URL"] = sv.Vcs.RemoteUrl
 	m["CIMPLE_VCS_REMOTE_NAME"] = sv.Vcs.RemoteName
+	m["CIMPLE_VCS_TAG"] = sv.Vcs.Tag
+
+	if len(sv.OutputFile) != 0 {
+		m["CIMPLE_OUTPUT"] = sv.OutputFile
+	}
+
+	for k, v := range sv.Matrix {
+		m["CIMPLE_MATRIX_"+strings.ToUpper(k)] = v
+	}
+
+	for k, v := range sv.Params {
+		m["CIMPLE_PARAM_"+strings.ToUpper(k)] = v
+	}
+
+	for task, steps := range sv.Outputs {
+		for step, values := range steps {
+			for k, v := range values {
+				m[outputVariable(task, step, k)] = v
+			}
+		}
+	}
 
 	m = merge(m, sv.StepEnv)
 
@@ -84,8 +151,16 @@ func (sv *StepVars) Map() map[string]string {
 
 type Step interface {
 	GetSkip() bool
+	GetWhen() string
 	GetName() string
 	GetEnv() map[string]string
+	GetRetry() Retry
+	// GetAlways reports whether the step runs after an earlier step of the
+	// task failed.
+	GetAlways() bool
+	// GetAllowFailure reports whether a failure of the step is recorded
+	// without failing the task.
+	GetAllowFailure() bool
 	Execute(vars StepVars, stdout io.Writer, stderr io.Writer) error
 }
 
@@ -99,6 +174,9 @@ type Project struct {
 	Description string
 	Version     string
 	Env         map[string]string
+	// StrictTemplates fails templates which reference a missing key rather
+	// than rendering <no value>.
+	StrictTemplates bool
 }
 
 type ConfigError struct {
@@ -115,16 +193,26 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	return Load(string(d))
+	return load(string(d), filepath.Dir(path))
 }
 
 func Load(str string) (*Config, error) {
+	return load(str, ".")
+}
+
+func load(str string, dir string) (*Config, error) {
 	obj, err := hcl.Parse(str)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg, err := parseConfig(obj)
+	if list, ok := obj.Node.(*ast.ObjectList); ok {
+		if _, err := migrateSchema(list); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg, err := parseConfig(obj, dir)
 	if err != nil {
 		return nil, err
 	}
@@ -136,14 +224,13 @@ func Load(str string) (*Config, error) {
 	return cfg, nil
 }
 
-func parseConfig(obj *ast.File) (*Config, error) {
+func parseConfig(obj *ast.File, dir string) (*Config, error) {
 	var m map[string]interface{}
 	if err := hcl.DecodeObject(&m, obj); err != nil {
 		return nil, err
 	}
 
 	var result Config
-	result.Tasks = make(map[string]*Task)
 
 	if err := mapstructure.WeakDecode(m, &result); err != nil {
 		return nil, err
@@ -162,26 +249,82 @@ func parseConfig(obj *ast.File) (*Config, error) {
 		result.Project.Description = val.(string)
 	}
 
-	result.Project.Env = make(map[string]string)
+	if val, ok := m["strict_templates"]; ok {
+		strict, ok := val.(bool)
+		if !ok {
+			return nil, &ConfigError{
+				Issues: []string{"strict_templates must be a boolean"},
+			}
+		}
+		result.Project.StrictTemplates = strict
+	}
 
 	list, ok := obj.Node.(*ast.ObjectList)
 	if !ok {
 		return nil, fmt.Errorf("Node is not an ObjectList")
 	}
 
-	matches := list.Filter("task")
-	for _, m := range matches.Items {
-		err := parseTask(result.Tasks, m)
+	tasks, env, err := parseTasksAndEnv(list, dir, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	expandMatrixDependencies(tasks)
+
+	result.Tasks = tasks
+	result.Project.Env = env
+
+	return &result, nil
+}
+
+// parseTasksAndEnv parses the tasks and env within a configuration, merging in
+// those from any included configurations.
+func parseTasksAndEnv(list *ast.ObjectList, dir string, visited map[string]bool) (map[string]*Task, map[string]string, error) {
+	tasks := make(map[string]*Task)
+	env := make(map[string]string)
+
+	for _, item := range list.Filter("include").Items {
+		inc, err := parseInclude(item)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+
+		includedTasks, includedEnv, err := loadInclude(inc, dir, visited)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for k, v := range includedTasks {
+			// Overrides only apply to tasks defined in the including configuration.
+			v.Override = false
+			includedTasks[k] = v
+		}
+
+		if issues := mergeTasks(tasks, includedTasks, inc.name); len(issues) != 0 {
+			return nil, nil, &ConfigError{Issues: issues}
+		}
+
+		env = merge(env, includedEnv)
 	}
 
-	if err := parseEnvs(result.Project.Env, list.Filter("env")); err != nil {
-		return nil, err
+	localTasks := make(map[string]*Task)
+	for _, m := range list.Filter("task").Items {
+		err := parseTask(localTasks, m)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return &result, nil
+	if issues := mergeTasks(tasks, localTasks, "the including configuration"); len(issues) != 0 {
+		return nil, nil, &ConfigError{Issues: issues}
+	}
+
+	localEnv := make(map[string]string)
+	if err := parseEnvs(localEnv, list.Filter("env")); err != nil {
+		return nil, nil, err
+	}
+
+	return tasks, merge(env, localEnv), nil
 }
 
 func parseTask(tasks map[string]*Task, item *ast.ObjectItem) error {
@@ -191,6 +334,11 @@ func parseTask(tasks map[string]*Task, item *ast.ObjectItem) error {
 	}
 
 	delete(m, "env")
+	delete(m, "matrix")
+	delete(m, "param")
+	delete(m, "service")
+	delete(m, "cache")
+	delete(m, "finally")
 
 	var task Task
 	task.Name = item.Keys[0].Token.Value().(string)
@@ -213,51 +361,150 @@ func parseTask(tasks map[string]*Task, item *ast.ObjectItem) error {
 		listVal = ot.List
 	}
 
-	stepParsers := []StepParser{&ScriptStepParser{}, &CommandStepParser{}, &PublishParser{}}
-
 	so, err := stepOrder(listVal)
 	if err != nil {
 		return err
 	}
 	task.StepOrder = so
 
+	if err := parseSteps(task.Steps, listVal); err != nil {
+		return err
+	}
+
+	finally, finallyOrder, err := parseFinally(listVal.Filter("finally"), task.Steps)
+	if err != nil {
+		return err
+	}
+	task.Finally = finally
+	task.FinallyOrder = finallyOrder
+
+	if err := parseEnvs(task.Env, listVal.Filter("env")); err != nil {
+		return err
+	}
+
+	params, err := parseParams(listVal.Filter("param"))
+	if err != nil {
+		return err
+	}
+	task.Params = params
+
+	services, err := parseServices(listVal.Filter("service"))
+	if err != nil {
+		return err
+	}
+	task.Services = services
+
+	caches, err := parseCaches(listVal.Filter("cache"))
+	if err != nil {
+		return err
+	}
+	task.Caches = caches
+
+	mx, err := parseMatrix(listVal.Filter("matrix"))
+	if err != nil {
+		return err
+	}
+
+	if taskExists(tasks, task.Name) {
+		return &ConfigError{
+			Issues: []string{fmt.Sprintf("A task named %s exists multiple times", task.Name)},
+		}
+	}
+
+	if mx == nil {
+		tasks[task.Name] = &task
+		return nil
+	}
+
+	for _, variant := range mx.expand(&task) {
+		tasks[variant.Name] = variant
+	}
+
+	return nil
+}
+
+// parseSteps adds the steps within list to steps.
+func parseSteps(steps map[string]Step, list *ast.ObjectList) error {
 	for _, sp := range stepParsers {
-		if o := listVal.Filter(sp.GetToken()); len(o.Items) > 0 {
-			steps := make([]Step, 0)
+		for _, item := range list.Filter(sp.GetToken()).Items {
+			step, err := sp.Parse(item)
+			if err != nil {
+				return err
+			}
 
-			for _, item := range o.Items {
-				step, err := sp.Parse(item)
-				if err != nil {
-					return err
+			if _, exists := steps[step.GetName()]; exists {
+				return &ConfigError{
+					Issues: []string{fmt.Sprintf("A step named %s exists multiple times", step.GetName())},
 				}
-				steps = append(steps, step)
 			}
+			steps[step.GetName()] = step
+		}
+	}
 
-			for _, st := range steps {
-				if _, exists := task.Steps[st.GetName()]; exists {
-					return &ConfigError{
-						Issues: []string{fmt.Sprintf("A step named %s exists multiple times", st.GetName())},
-					}
-				}
-				task.Steps[st.GetName()] = st
+	return checkParallelStepNames(steps)
+}
+
+// parseFinally parses the finally block of a task, if it has one. The names of
+// its steps must differ from those of the steps of the task.
+func parseFinally(list *ast.ObjectList, taskSteps map[string]Step) (map[string]Step, []string, error) {
+	if len(list.Items) == 0 {
+		return nil, nil, nil
+	}
+
+	if len(list.Items) > 1 {
+		return nil, nil, &ConfigError{
+			Issues: []string{"A task can only contain a single finally block"},
+		}
+	}
+
+	ot, ok := list.Items[0].Val.(*ast.ObjectType)
+	if !ok {
+		return nil, nil, &ConfigError{
+			Issues: []string{"finally must be a block of steps"},
+		}
+	}
+
+	order, err := stepOrder(ot.List)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	steps := make(map[string]Step)
+	for _, name := range order {
+		if _, exists := taskSteps[name]; exists {
+			return nil, nil, &ConfigError{
+				Issues: []string{fmt.Sprintf("A step named %s exists multiple times", name)},
 			}
 		}
 	}
 
-	if err := parseEnvs(task.Env, listVal.Filter("env")); err != nil {
-		return err
+	if err := parseSteps(steps, ot.List); err != nil {
+		return nil, nil, err
 	}
 
-	_, exists := tasks[task.Name]
-	if exists {
-		return &ConfigError{
-			Issues: []string{fmt.Sprintf("A task named %s exists multiple times", task.Name)},
+	return steps, order, nil
+}
+
+func taskExists(tasks map[string]*Task, name string) bool {
+	for _, t := range tasks {
+		if t.Name == name || t.BaseName == name {
+			return true
 		}
 	}
 
-	tasks[task.Name] = &task
+	return false
+}
+
+var stepParsers = []StepParser{&ScriptStepParser{}, &CommandStepParser{}, &ContainerStepParser{}, &PublishParser{}, &ParallelStepParser{}}
 
-	return nil
+func isStepToken(key string) bool {
+	for _, sp := range stepParsers {
+		if sp.GetToken() == key {
+			return true
+		}
+	}
+
+	return false
 }
 
 func stepOrder(o *ast.ObjectList) ([]string, error) {
@@ -267,7 +514,7 @@ func stepOrder(o *ast.ObjectList) ([]string, error) {
 		for _, keyItem := range item.Keys {
 			key := keyItem.Token.Value().(string)
 
-			if key == "command" || key == "script" || key == "publish" {
+			if isStepToken(key) {
 				n := item.Keys[1].Token.Value().(string)
 				result = append(result, n)
 			}
@@ -277,20 +524,42 @@ func stepOrder(o *ast.ObjectList) ([]string, error) {
 	return result, nil
 }
 
+var validName = regexp.MustCompile("^[a-z0-9_-]+$")
+
 func validateConfig(cfg *Config) error {
 	var issues = []string{}
 
-	r, _ := regexp.Compile("[a-z0-9_]+")
+	r := validName
 
 	for taskName, task := range cfg.Tasks {
+		if len(task.BaseName) != 0 {
+			taskName = task.BaseName
+		}
+
 		if !r.MatchString(taskName) {
 			issues = append(issues, fmt.Sprintf("%s is not a valid task name", taskName))
 		}
 
-		for stepName, _ := range task.Steps {
+		steps := make(map[string]Step)
+		for stepName, step := range task.Steps {
+			steps[stepName] = step
+		}
+		for stepName, step := range task.Finally {
+			steps[stepName] = step
+		}
+
+		for stepName, step := range steps {
 			if !r.MatchString(stepName) {
 				issues = append(issues, fmt.Sprintf("%s is not a valid step name", stepName))
 			}
+
+			if group, ok := step.(ParallelStep); ok {
+				for _, member := range group.Steps {
+					if !r.MatchString(member.GetName()) {
+						issues = append(issues, fmt.Sprintf("%s is not a valid step name", member.GetName()))
+					}
+				}
+			}
 		}
 	}
 
@@ -307,12 +576,10 @@ func parseEnvs(result map[string]string, list *ast.ObjectList) error {
 	for _, item := range list.Elem().Items {
 		var m map[string]interface{}
 		if err := hcl.DecodeObject(&m, item.Val); err != nil {
-			log.Fatal(err)
 			return err
 		}
 
 		if err := mapstructure.WeakDecode(m, &result); err != nil {
-			log.Fatal(err)
 			return err
 		}
 	}
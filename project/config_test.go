@@ -276,3 +276,319 @@ func Test_StepVars_Map_Precedence(t *testing.T) {
 		t.Fatalf("Expected CIMPLE_PROJECT_NAME to be overriden from StepEnv")
 	}
 }
+
+func TestParseMatrix(t *testing.T) {
+	assert := assert.New(t)
+
+	file := "matrix.hcl"
+	path, err := filepath.Abs(filepath.Join("./test-fixtures", file))
+	if err != nil {
+		t.Fatalf("File: %s\n\n%s", file, err)
+	}
+
+	actual, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("file: %s\n\n%s", file, err)
+	}
+
+	assert.Equal(5, len(actual.Tasks))
+
+	variant, ok := actual.Tasks["test[go=1.8,goos=linux]"]
+	if assert.True(ok) {
+		assert.Equal("test", variant.BaseName)
+		assert.Equal(map[string]string{"go": "1.8", "goos": "linux"}, variant.Matrix)
+		assert.False(variant.FailFast)
+		assert.Equal([]string{"gotest"}, variant.StepOrder)
+		assert.Contains(variant.Steps, "gotest")
+	}
+
+	assert.Equal([]string{
+		"test[go=1.7,goos=darwin]",
+		"test[go=1.7,goos=linux]",
+		"test[go=1.8,goos=darwin]",
+		"test[go=1.8,goos=linux]",
+	}, actual.Tasks["package"].Depends)
+}
+
+func TestParseMatrix_DefaultsToFailFast(t *testing.T) {
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+
+	task test {
+		matrix {
+			go = ["1.8"]
+		}
+	}
+	`
+
+	cfg, err := Load(testconfig)
+	if assert.Nil(t, err) {
+		assert.True(t, cfg.Tasks["test[go=1.8]"].FailFast)
+	}
+}
+
+func TestParseMatrix_DuplicateTaskName(t *testing.T) {
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+
+	task test {
+		matrix {
+			go = ["1.8"]
+		}
+	}
+
+	task test {
+	}
+	`
+
+	_, err := Load(testconfig)
+	assert.IsType(t, &ConfigError{}, err)
+}
+
+func TestParseTaskSelector(t *testing.T) {
+	assert := assert.New(t)
+
+	name, values, err := ParseTaskSelector("test[go=1.8, goos=linux]")
+	if assert.Nil(err) {
+		assert.Equal("test", name)
+		assert.Equal(map[string]string{"go": "1.8", "goos": "linux"}, values)
+	}
+
+	name, values, err = ParseTaskSelector("test")
+	if assert.Nil(err) {
+		assert.Equal("test", name)
+		assert.Empty(values)
+	}
+
+	_, _, err = ParseTaskSelector("test[go")
+	assert.NotNil(err)
+}
+
+func Test_StepVars_Map_Matrix(t *testing.T) {
+	vars := new(StepVars)
+	vars.Cimple = &env.CimpleEnvironment{}
+	vars.Matrix = map[string]string{"go": "1.8"}
+
+	m := vars.Map()
+
+	if m["CIMPLE_MATRIX_GO"] != "1.8" {
+		t.Fatalf("Expected CIMPLE_MATRIX_GO to be 1.8 - was %s", m["CIMPLE_MATRIX_GO"])
+	}
+}
+
+func Test_StepVars_Map_Outputs(t *testing.T) {
+	vars := new(StepVars)
+	vars.Cimple = &env.CimpleEnvironment{}
+	vars.Outputs = Outputs{"package": {"build-binary": {"label": "1.2.3"}}}
+
+	m := vars.Map()
+
+	if m["CIMPLE_OUTPUT_PACKAGE_BUILD_BINARY_LABEL"] != "1.2.3" {
+		t.Fatalf("Expected CIMPLE_OUTPUT_PACKAGE_BUILD_BINARY_LABEL to be 1.2.3 - was %s", m["CIMPLE_OUTPUT_PACKAGE_BUILD_BINARY_LABEL"])
+	}
+}
+
+func Test_outputVariable(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("CIMPLE_OUTPUT_TEST_GO_1_8_OS_LINUX__BUILD_BINARY_APP_ID", outputVariable("test[go=1.8,os=linux]", "build-binary", "app.id"))
+	assert.Equal("CIMPLE_OUTPUT_PACKAGE_VERSION_A_B", outputVariable("package", "version", "a=b"))
+}
+
+func TestParseInclude(t *testing.T) {
+	assert := assert.New(t)
+
+	file := "include.hcl"
+	path, err := filepath.Abs(filepath.Join("./test-fixtures", file))
+	if err != nil {
+		t.Fatalf("File: %s\n\n%s", file, err)
+	}
+
+	actual, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("file: %s\n\n%s", file, err)
+	}
+
+	assert.Equal(3, len(actual.Tasks))
+	assert.Contains(actual.Tasks, "fix")
+	assert.Contains(actual.Tasks, "package")
+
+	script := actual.Tasks["test"].Steps["gotest"].(Script)
+	assert.Equal("go test -v ./...", script.Body)
+
+	assert.Equal(map[string]string{
+		"library_env": "library",
+		"shared_env":  "project",
+	}, actual.Project.Env)
+}
+
+func TestParseInclude_TaskNameCollision(t *testing.T) {
+	file := "include-collision.hcl"
+	path, err := filepath.Abs(filepath.Join("./test-fixtures", file))
+	if err != nil {
+		t.Fatalf("File: %s\n\n%s", file, err)
+	}
+
+	_, err = LoadConfig(path)
+	assert.IsType(t, &ConfigError{}, err)
+}
+
+func TestParseInclude_Git(t *testing.T) {
+	assert := assert.New(t)
+
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+
+	include library {
+		git = "https://example.com/library.git"
+		revision = "abc123"
+		path = "include-library.hcl"
+	}
+	`
+
+	var fetched string
+	original := fetchGitInclude
+	defer func() { fetchGitInclude = original }()
+	fetchGitInclude = func(url string, revision string, dir string) (string, error) {
+		fetched = fmt.Sprintf("%s@%s", url, revision)
+		return filepath.Abs("./test-fixtures")
+	}
+
+	cfg, err := Load(testconfig)
+	if assert.Nil(err) {
+		assert.Equal("https://example.com/library.git@abc123", fetched)
+		assert.Equal(2, len(cfg.Tasks))
+	}
+}
+
+func TestParseInclude_GitRequiresRevision(t *testing.T) {
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+
+	include library {
+		git = "https://example.com/library.git"
+		path = "include-library.hcl"
+	}
+	`
+
+	_, err := Load(testconfig)
+	assert.IsType(t, &ConfigError{}, err)
+}
+
+func TestPartiallyValidTaskNameIsInvalid(t *testing.T) {
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+	task Build {
+	}
+	`
+
+	_, err := Load(testconfig)
+	assert.IsType(t, &ConfigError{}, err)
+}
+
+func TestParseAlwaysAndAllowFailure(t *testing.T) {
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+	task test {
+		command lint {
+			command = "golint"
+			allow_failure = true
+		}
+
+		script teardown {
+			body = "docker-compose down"
+			always = true
+		}
+	}
+	`
+
+	cfg, err := Load(testconfig)
+	if assert.Nil(t, err) {
+		steps := cfg.Tasks["test"].Steps
+		assert.True(t, steps["lint"].GetAllowFailure())
+		assert.False(t, steps["lint"].GetAlways())
+		assert.True(t, steps["teardown"].GetAlways())
+		assert.False(t, steps["teardown"].GetAllowFailure())
+	}
+}
+
+func TestParseFinally(t *testing.T) {
+	assert := assert.New(t)
+
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+	task test {
+		command test {
+			command = "go"
+		}
+
+		finally {
+			script logs {
+				body = "docker logs db"
+			}
+
+			command down {
+				command = "docker-compose"
+			}
+		}
+	}
+	`
+
+	cfg, err := Load(testconfig)
+	if assert.Nil(err) {
+		task := cfg.Tasks["test"]
+		assert.Equal([]string{"test"}, task.StepOrder)
+		assert.Equal([]string{"logs", "down"}, task.FinallyOrder)
+		assert.Contains(task.Finally, "logs")
+		assert.Contains(task.Finally, "down")
+	}
+}
+
+func TestParseFinally_StepNamesUniqueWithinATask(t *testing.T) {
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+	task test {
+		command down {
+			command = "docker-compose"
+		}
+
+		finally {
+			command down {
+				command = "docker-compose"
+			}
+		}
+	}
+	`
+
+	_, err := Load(testconfig)
+	assert.Equal(t, &ConfigError{
+		Issues: []string{"A step named down exists multiple times"},
+	}, err)
+}
+
+func TestParseFinally_SingleBlock(t *testing.T) {
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+	task test {
+		finally {
+		}
+
+		finally {
+		}
+	}
+	`
+
+	_, err := Load(testconfig)
+	assert.Equal(t, &ConfigError{
+		Issues: []string{"A task can only contain a single finally block"},
+	}, err)
+}
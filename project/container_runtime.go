@@ -0,0 +1,81 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"os"
+	exec "os/exec"
+	"sort"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// ContainerOptions describes how a container step is run.
+type ContainerOptions struct {
+	Image string
+	// Script is run by /bin/sh within the container.
+	Script string
+	Env    map[string]string
+	// HostDir is mounted into the container at WorkingDir.
+	HostDir    string
+	WorkingDir string
+	// User is the user, or uid:gid, the script is run as. The image's user is
+	// used when empty.
+	User    string
+	Timeout time.Duration
+	// Cancel stops the container when closed.
+	Cancel <-chan struct{}
+}
+
+// ContainerRuntime runs container steps.
+type ContainerRuntime interface {
+	Run(options *ContainerOptions, stdout io.Writer, stderr io.Writer) error
+}
+
+// DockerRuntime runs containers using the docker command line client.
+type DockerRuntime struct {
+}
+
+func (r *DockerRuntime) Run(options *ContainerOptions, stdout io.Writer, stderr io.Writer) error {
+	name := fmt.Sprintf("cimple-%s", uuid.NewV4())
+
+	args := []string{
+		"run", "--rm",
+		"--name", name,
+		"-v", fmt.Sprintf("%s:%s", options.HostDir, options.WorkingDir),
+		"-w", options.WorkingDir,
+	}
+
+	if len(options.User) != 0 {
+		args = append(args, "-u", options.User)
+	}
+
+	keys := []string{}
+	for k := range options.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Values are passed through the environment of the docker client so
+	// they are not visible in the process list.
+	cmd := exec.Command("docker")
+	cmd.Env = os.Environ()
+	for _, k := range keys {
+		args = append(args, "-e", k)
+		cmd.Env = append(cmd.Env, k+"="+options.Env[k])
+	}
+
+	args = append(args, options.Image, "/bin/sh", "-c", options.Script)
+	cmd.Args = append(cmd.Args, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := runProcess(cmd, options.Timeout, options.Cancel)
+	if err != nil {
+		// Killing the client does not stop the container so ensure it has gone.
+		exec.Command("docker", "rm", "-f", name).Run()
+	}
+
+	return err
+}
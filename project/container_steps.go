@@ -0,0 +1,203 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/mitchellh/mapstructure"
+)
+
+type ContainerStepParser struct {
+	// Runtime runs the parsed container steps. The docker CLI is used when
+	// no runtime is given.
+	Runtime ContainerRuntime
+}
+
+func (st ContainerStepParser) GetToken() string {
+	return "container"
+}
+
+func (st ContainerStepParser) GetAttributes() []string {
+	return []string{"image", "body", "working_dir", "user", "env", "skip", "when", "always", "allow_failure", "timeout", "retry"}
+}
+
+func (st ContainerStepParser) Parse(item *ast.ObjectItem) (Step, error) {
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return nil, err
+	}
+
+	delete(m, "env")
+	delete(m, "retry")
+
+	name := item.Keys[0].Token.Value().(string)
+	var c Container
+	c.Env = make(map[string]string)
+	if err := mapstructure.WeakDecode(m, &c); err != nil {
+		return nil, err
+	}
+
+	c.name = name
+	c.runtime = st.Runtime
+	if c.runtime == nil {
+		c.runtime = &DockerRuntime{}
+	}
+
+	if len(c.Image) == 0 {
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("Container step %s must specify an image", name)},
+		}
+	}
+
+	var listVal *ast.ObjectList
+	if ot, ok := item.Val.(*ast.ObjectType); ok {
+		listVal = ot.List
+	}
+
+	if err := parseEnvs(c.Env, listVal.Filter("env")); err != nil {
+		return nil, err
+	}
+
+	if _, err := parseTimeout(c.Timeout); err != nil {
+		return nil, err
+	}
+
+	retry, err := parseRetry(listVal.Filter("retry"))
+	if err != nil {
+		return nil, err
+	}
+	c.Retry = retry
+
+	return c, nil
+}
+
+// Container is a step which runs its body within a container image with the
+// working directory mounted.
+type Container struct {
+	name         string
+	runtime      ContainerRuntime
+	Image        string
+	Body         string
+	WorkingDir   string `mapstructure:"working_dir"`
+	User         string
+	Env          map[string]string
+	Skip         bool
+	When         string
+	Timeout      string
+	Retry        Retry
+	Always       bool
+	AllowFailure bool `mapstructure:"allow_failure"`
+}
+
+func (c Container) GetName() string {
+	return c.name
+}
+
+func (c Container) GetSkip() bool {
+	return c.Skip
+}
+
+func (c Container) GetWhen() string {
+	return c.When
+}
+
+func (c Container) GetEnv() map[string]string {
+	return c.Env
+}
+
+func (c Container) GetRetry() Retry {
+	return c.Retry
+}
+
+func (c Container) GetAlways() bool {
+	return c.Always
+}
+
+func (c Container) GetAllowFailure() bool {
+	return c.AllowFailure
+}
+
+func (c Container) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) error {
+	body, err := c.templateBody(vars)
+	if err != nil {
+		return err
+	}
+
+	env, err := c.templatedEnvs(vars)
+	if err != nil {
+		return err
+	}
+
+	timeout, err := parseTimeout(c.Timeout)
+	if err != nil {
+		return err
+	}
+
+	workdir := c.WorkingDir
+	if len(workdir) == 0 {
+		workdir = vars.WorkingDir
+	}
+
+	user := c.User
+	if len(user) == 0 {
+		user = currentUser()
+	}
+
+	// The output file is only reachable when it is within the mounted working
+	// directory, so it is translated to its path within the container.
+	delete(env, "CIMPLE_OUTPUT")
+	if rel, err := filepath.Rel(vars.WorkingDir, vars.OutputFile); len(vars.OutputFile) != 0 && err == nil && !strings.HasPrefix(rel, "..") {
+		env["CIMPLE_OUTPUT"] = path.Join(workdir, filepath.ToSlash(rel))
+	}
+
+	return c.runtime.Run(&ContainerOptions{
+		Image:      c.Image,
+		Script:     body,
+		Env:        env,
+		HostDir:    vars.WorkingDir,
+		WorkingDir: workdir,
+		User:       user,
+		Timeout:    timeout,
+		Cancel:     vars.Cancel,
+	}, stdout, stderr)
+}
+
+// currentUser is the uid:gid containers run as by default, so the files they
+// write to the mounted working directory are owned by the user running cimple
+// rather than root. It is empty where there are no uids, such as on windows.
+var currentUser = func() string {
+	uid := os.Getuid()
+	if uid < 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d:%d", uid, os.Getgid())
+}
+
+func (c Container) templateBody(vars StepVars) (string, error) {
+	return renderTemplate(c.name+".body", c.Body, vars)
+}
+
+// templatedEnvs builds the environment of the container. Variables which are
+// only present in the host environment, such as PATH, are left out as they
+// describe the host rather than the image.
+func (c Container) templatedEnvs(vars StepVars) (map[string]string, error) {
+	env := make(map[string]string)
+
+	for k, v := range vars.Map() {
+		if _, host := vars.HostEnv[k]; host {
+			if _, step := vars.StepEnv[k]; !step {
+				continue
+			}
+		}
+		env[k] = v
+	}
+
+	return renderEnvs(c.name, env, vars)
+}
@@ -0,0 +1,134 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/lukesmith/cimple/env"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRuntime struct {
+	options *ContainerOptions
+}
+
+func (r *fakeRuntime) Run(options *ContainerOptions, stdout io.Writer, stderr io.Writer) error {
+	r.options = options
+	return nil
+}
+
+func TestContainerStepParser_Parse(t *testing.T) {
+	assert := assert.New(t)
+
+	containerHcl := `
+container gotest {
+	image = "golang:1.8"
+	body = "go test ./..."
+	timeout = "10m"
+	working_dir = "/go/src/app"
+	user = "root"
+	env {
+		GOOS = "linux"
+	}
+}
+`
+	item, err := extractStep(containerHcl, "container")
+	if assert.Nil(err) {
+		parser := &ContainerStepParser{}
+		step, err := parser.Parse(item)
+		if assert.Nil(err) {
+			container := step.(Container)
+			assert.Equal("gotest", container.GetName())
+			assert.Equal("golang:1.8", container.Image)
+			assert.Equal("go test ./...", container.Body)
+			assert.Equal("10m", container.Timeout)
+			assert.Equal("/go/src/app", container.WorkingDir)
+			assert.Equal("root", container.User)
+			assert.Equal("linux", container.Env["GOOS"])
+			assert.IsType(&DockerRuntime{}, container.runtime)
+		}
+	}
+}
+
+func TestContainerStepParser_RequiresImage(t *testing.T) {
+	containerHcl := `
+container gotest {
+	body = "go test ./..."
+}
+`
+	item, err := extractStep(containerHcl, "container")
+	if assert.Nil(t, err) {
+		parser := &ContainerStepParser{}
+		_, err := parser.Parse(item)
+		assert.IsType(t, &ConfigError{}, err)
+	}
+}
+
+func TestContainer_Execute(t *testing.T) {
+	assert := assert.New(t)
+
+	runtime := &fakeRuntime{}
+	container := Container{
+		runtime: runtime,
+		Image:   "golang:1.8",
+		Body:    "echo {{.TaskName}}",
+		Env:     map[string]string{},
+	}
+
+	vars := StepVars{
+		Cimple:     &env.CimpleEnvironment{},
+		TaskName:   "test",
+		WorkingDir: "/c/temp",
+		HostEnv:    map[string]string{"PATH": "/usr/bin", "HOME": "/root"},
+		StepEnv:    map[string]string{"HOME": "/workspace"},
+	}
+	var out bytes.Buffer
+	err := container.Execute(vars, &out, &out)
+
+	if assert.Nil(err) {
+		assert.Equal("golang:1.8", runtime.options.Image)
+		assert.Equal("echo test", runtime.options.Script)
+		assert.Equal("/c/temp", runtime.options.HostDir)
+		assert.Equal("/c/temp", runtime.options.WorkingDir)
+		assert.Equal("test", runtime.options.Env["CIMPLE_TASK_NAME"])
+		assert.Equal("/workspace", runtime.options.Env["HOME"])
+		assert.NotContains(runtime.options.Env, "PATH")
+		assert.Equal(fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()), runtime.options.User)
+	}
+
+	container.User = "root"
+	if assert.Nil(container.Execute(vars, &out, &out)) {
+		assert.Equal("root", runtime.options.User)
+	}
+}
+
+func TestContainer_ExecuteTranslatesOutputFile(t *testing.T) {
+	assert := assert.New(t)
+
+	runtime := &fakeRuntime{}
+	container := Container{
+		runtime:    runtime,
+		Image:      "golang:1.8",
+		WorkingDir: "/go/src/app",
+		Env:        map[string]string{},
+	}
+
+	vars := StepVars{
+		Cimple:     &env.CimpleEnvironment{},
+		WorkingDir: "/c/temp",
+		OutputFile: "/c/temp/.cimple/app/1/outputs/package/version",
+	}
+	var out bytes.Buffer
+
+	if assert.Nil(container.Execute(vars, &out, &out)) {
+		assert.Equal("/go/src/app/.cimple/app/1/outputs/package/version", runtime.options.Env["CIMPLE_OUTPUT"])
+	}
+
+	vars.OutputFile = "/tmp/cimple-output"
+	if assert.Nil(container.Execute(vars, &out, &out)) {
+		assert.NotContains(runtime.options.Env, "CIMPLE_OUTPUT")
+	}
+}
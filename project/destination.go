@@ -0,0 +1,124 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/mitchellh/mapstructure"
+)
+
+// DestinationParser creates a publish destination from a destination block,
+// validating the attributes it contains.
+type DestinationParser func(item *ast.ObjectItem) (PublishDestination, error)
+
+// destinationParsers are the destination types available to publish steps,
+// keyed by the label of the destination block.
+var destinationParsers = map[string]DestinationParser{
+	"bintray":   parseBintrayDestination,
+	"directory": parseDirectoryDestination,
+	"http":      parseHttpDestination,
+	"s3":        parseS3Destination,
+}
+
+// RegisterDestination makes a destination type available to publish steps,
+// replacing any existing destination of the same type.
+func RegisterDestination(destinationType string, parser DestinationParser) {
+	destinationParsers[destinationType] = parser
+}
+
+// DestinationTypes returns the registered destination types.
+func DestinationTypes() []string {
+	types := []string{}
+	for t := range destinationParsers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func parseDestination(item *ast.ObjectItem) (PublishDestination, error) {
+	if len(item.Keys) == 0 {
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("A destination must specify its type. Available options %s", strings.Join(DestinationTypes(), ", "))},
+		}
+	}
+
+	destinationType := item.Keys[0].Token.Value().(string)
+	parser, ok := destinationParsers[destinationType]
+	if !ok {
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("Unknown destination type %s. Available options %s", destinationType, strings.Join(DestinationTypes(), ", "))},
+		}
+	}
+
+	return parser(item)
+}
+
+// DecodeDestination decodes the attributes of a destination block into
+// target, reporting attributes target does not have. Blocks named in skip are
+// left for the caller to decode.
+func DecodeDestination(item *ast.ObjectItem, target interface{}, skip ...string) error {
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return err
+	}
+
+	for _, s := range skip {
+		delete(m, s)
+	}
+
+	destinationType := item.Keys[0].Token.Value().(string)
+
+	var md mapstructure.Metadata
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		Metadata:         &md,
+		Result:           target,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := decoder.Decode(m); err != nil {
+		return &ConfigError{
+			Issues: []string{fmt.Sprintf("Invalid %s destination - %s", destinationType, err)},
+		}
+	}
+
+	if len(md.Unused) != 0 {
+		sort.Strings(md.Unused)
+		issues := []string{}
+		for _, u := range md.Unused {
+			issues = append(issues, fmt.Sprintf("Unknown attribute %s in %s destination", u, destinationType))
+		}
+		return &ConfigError{Issues: issues}
+	}
+
+	return nil
+}
+
+// requireAttributes reports the attributes of a destination which have not
+// been given a value.
+func requireAttributes(destinationType string, attributes map[string]string) error {
+	names := []string{}
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	issues := []string{}
+	for _, name := range names {
+		if len(attributes[name]) == 0 {
+			issues = append(issues, fmt.Sprintf("The %s destination must specify %s", destinationType, name))
+		}
+	}
+
+	if len(issues) != 0 {
+		return &ConfigError{Issues: issues}
+	}
+
+	return nil
+}
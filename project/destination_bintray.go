@@ -0,0 +1,76 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+var bintrayApiUrl = "https://api.bintray.com"
+
+func parseBintrayDestination(item *ast.ObjectItem) (PublishDestination, error) {
+	destination := &bintrayPublishDestination{}
+	if err := DecodeDestination(item, destination); err != nil {
+		return nil, err
+	}
+
+	if err := requireAttributes("bintray", map[string]string{
+		"subject":    destination.Subject,
+		"repository": destination.Repository,
+		"package":    destination.Package,
+		"username":   destination.Username,
+	}); err != nil {
+		return nil, err
+	}
+
+	return destination, nil
+}
+
+type bintrayPublishDestination struct {
+	Subject    string
+	Repository string
+	Package    string
+	Username   string
+}
+
+func (b bintrayPublishDestination) Execute(files []string, vars StepVars, stdout io.Writer, stderr io.Writer) error {
+	password, err := vars.Secrets.Get("bintray", b.Username)
+	if err != nil {
+		return err
+	}
+
+	uploader := &httpUploader{
+		client:         &http.Client{},
+		method:         "PUT",
+		expectedStatus: []int{http.StatusOK, http.StatusCreated},
+		username:       b.Username,
+		password:       password,
+		stdout:         stdout,
+	}
+
+	urls, err := b.Targets(files, vars)
+	if err != nil {
+		return err
+	}
+
+	for i, f := range files {
+		url := urls[i]
+		fmt.Fprintf(stdout, "Publishing %s to %s\n", f, url)
+		if err := uploader.upload(f, url, nil); err != nil {
+			return fmt.Errorf("Failed to publish %s - %s", f, err)
+		}
+	}
+
+	return nil
+}
+
+func (b bintrayPublishDestination) Targets(files []string, vars StepVars) ([]string, error) {
+	urls := []string{}
+	for _, f := range files {
+		urls = append(urls, fmt.Sprintf("%s/content/%s/%s/%s/%s/%s", bintrayApiUrl, b.Subject, b.Repository, b.Package, vars.Project.Version, filepath.Base(f)))
+	}
+	return urls, nil
+}
@@ -0,0 +1,91 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+// directoryPublishDestination copies the published files into a directory,
+// e.g. a mounted file share.
+type directoryPublishDestination struct {
+	Path string
+}
+
+func parseDirectoryDestination(item *ast.ObjectItem) (PublishDestination, error) {
+	destination := &directoryPublishDestination{}
+	if err := DecodeDestination(item, destination); err != nil {
+		return nil, err
+	}
+
+	if err := requireAttributes("directory", map[string]string{
+		"path": destination.Path,
+	}); err != nil {
+		return nil, err
+	}
+
+	return destination, nil
+}
+
+func (d directoryPublishDestination) Execute(files []string, vars StepVars, stdout io.Writer, stderr io.Writer) error {
+	targets, err := d.Targets(files, vars)
+	if err != nil {
+		return err
+	}
+
+	for i, f := range files {
+		target := targets[i]
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(stdout, "Publishing %s to %s\n", f, target)
+
+		if err := copyFile(f, target); err != nil {
+			return fmt.Errorf("Failed to publish %s - %s", f, err)
+		}
+	}
+
+	return nil
+}
+
+func (d directoryPublishDestination) Targets(files []string, vars StepVars) ([]string, error) {
+	dir, err := renderTemplate("destination.path", d.Path, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []string{}
+	for _, f := range files {
+		targets = append(targets, filepath.Join(dir, filepath.Base(f)))
+	}
+	return targets, nil
+}
+
+func copyFile(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
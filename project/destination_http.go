@@ -0,0 +1,374 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/mitchellh/mapstructure"
+)
+
+var defaultExpectedStatus = []int{http.StatusOK, http.StatusCreated, http.StatusNoContent}
+
+// statusResumeIncomplete is the reply of a server supporting resumable uploads
+// to a query for the size of a partial upload.
+const statusResumeIncomplete = 308
+
+// httpPublishDestination uploads each file to a templated url, e.g. of an
+// Artifactory, Nexus or WebDAV repository.
+type httpPublishDestination struct {
+	UrlTemplate    string `mapstructure:"url_template"`
+	Method         string
+	ExpectedStatus []int `mapstructure:"expected_status"`
+	// Resumable uploads the remainder of a file when retrying, using the size
+	// of the partial upload reported by the server.
+	Resumable bool
+	Headers   map[string]string
+	Auth      HttpAuth
+	Retry     Retry
+}
+
+// HttpAuth authenticates uploads using basic authentication with the http
+// secret of the username, or a bearer token using the http secret of token.
+type HttpAuth struct {
+	Type     string
+	Username string
+	Token    string
+}
+
+// publishFile is the data available to the templates of an http destination.
+type publishFile struct {
+	StepVars
+	File string
+	Path string
+}
+
+func parseHttpDestination(item *ast.ObjectItem) (PublishDestination, error) {
+	destination := &httpPublishDestination{Headers: make(map[string]string)}
+	if err := DecodeDestination(item, destination, "headers", "auth", "retry"); err != nil {
+		return nil, err
+	}
+
+	if err := requireAttributes("http", map[string]string{
+		"url_template": destination.UrlTemplate,
+	}); err != nil {
+		return nil, err
+	}
+
+	list := item.Val.(*ast.ObjectType).List
+	if err := parseEnvs(destination.Headers, list.Filter("headers")); err != nil {
+		return nil, err
+	}
+
+	retry, err := parseRetry(list.Filter("retry"))
+	if err != nil {
+		return nil, err
+	}
+	destination.Retry = retry
+
+	auth, err := parseHttpAuth(list.Filter("auth"))
+	if err != nil {
+		return nil, err
+	}
+	destination.Auth = auth
+
+	destination.Method = strings.ToUpper(destination.Method)
+	if len(destination.Method) == 0 {
+		destination.Method = "PUT"
+	}
+	if destination.Method != "PUT" && destination.Method != "POST" {
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("The http destination method must be PUT or POST - was %s", destination.Method)},
+		}
+	}
+
+	if destination.Resumable && destination.Method != "PUT" {
+		return nil, &ConfigError{
+			Issues: []string{"Only PUT uploads to an http destination can be resumable"},
+		}
+	}
+
+	if len(destination.ExpectedStatus) == 0 {
+		destination.ExpectedStatus = defaultExpectedStatus
+	}
+
+	return destination, nil
+}
+
+func parseHttpAuth(list *ast.ObjectList) (HttpAuth, error) {
+	var auth HttpAuth
+
+	if len(list.Items) == 0 {
+		return auth, nil
+	}
+
+	if len(list.Items) > 1 {
+		return auth, &ConfigError{
+			Issues: []string{"A destination can only contain a single auth block"},
+		}
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, list.Items[0].Val); err != nil {
+		return auth, err
+	}
+
+	if err := mapstructure.WeakDecode(m, &auth); err != nil {
+		return auth, err
+	}
+
+	switch auth.Type {
+	case "basic":
+		if len(auth.Username) == 0 {
+			return auth, &ConfigError{Issues: []string{"Basic auth must specify username"}}
+		}
+	case "bearer":
+		if len(auth.Token) == 0 {
+			return auth, &ConfigError{Issues: []string{"Bearer auth must specify token"}}
+		}
+	default:
+		return auth, &ConfigError{
+			Issues: []string{fmt.Sprintf("Unknown auth type %s. Available options basic, bearer", auth.Type)},
+		}
+	}
+
+	return auth, nil
+}
+
+func (d httpPublishDestination) Execute(files []string, vars StepVars, stdout io.Writer, stderr io.Writer) error {
+	uploader := &httpUploader{
+		client:         &http.Client{},
+		method:         d.Method,
+		expectedStatus: d.ExpectedStatus,
+		retry:          d.Retry,
+		resumable:      d.Resumable,
+		stdout:         stdout,
+	}
+
+	if len(d.Auth.Type) != 0 {
+		if vars.Secrets == nil {
+			return fmt.Errorf("No secrets are available to retrieve the http %s secret", d.Auth.Type)
+		}
+
+		key := d.Auth.Username
+		if d.Auth.Type == "bearer" {
+			key = d.Auth.Token
+		}
+
+		secret, err := vars.Secrets.Get("http", key)
+		if err != nil {
+			return err
+		}
+
+		if d.Auth.Type == "bearer" {
+			uploader.token = secret
+		} else {
+			uploader.username = d.Auth.Username
+			uploader.password = secret
+		}
+	}
+
+	urls, err := d.Targets(files, vars)
+	if err != nil {
+		return err
+	}
+
+	for i, f := range files {
+		url := urls[i]
+		data := publishFile{StepVars: vars, File: filepath.Base(f), Path: f}
+
+		headers := make(map[string]string)
+		for k, v := range d.Headers {
+			if headers[k], err = renderPublishTemplate(fmt.Sprintf("destination.headers.%s", k), v, data); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(stdout, "Publishing %s to %s\n", f, url)
+		if err := uploader.upload(f, url, headers); err != nil {
+			return fmt.Errorf("Failed to publish %s - %s", f, err)
+		}
+	}
+
+	return nil
+}
+
+func (d httpPublishDestination) Targets(files []string, vars StepVars) ([]string, error) {
+	urls := []string{}
+	for _, f := range files {
+		url, err := renderPublishTemplate("destination.url_template", d.UrlTemplate, publishFile{StepVars: vars, File: filepath.Base(f), Path: f})
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
+
+func renderPublishTemplate(name string, text string, data publishFile) (string, error) {
+	tmpl, err := parseTemplate(name, text, data.StepVars)
+	if err != nil {
+		return "", err
+	}
+
+	var doc bytes.Buffer
+	if err := tmpl.Execute(&doc, data); err != nil {
+		return "", err
+	}
+
+	return doc.String(), nil
+}
+
+// httpUploader uploads files with a single request each, retrying requests
+// which fail with a network error or a server error.
+type httpUploader struct {
+	client         *http.Client
+	method         string
+	expectedStatus []int
+	retry          Retry
+	resumable      bool
+	username       string
+	password       string
+	token          string
+	stdout         io.Writer
+}
+
+func (u *httpUploader) upload(file string, url string, headers map[string]string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	var lastErr error
+	attempts := u.retry.GetAttempts()
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			backoff := u.retry.GetBackoff(attempt - 1)
+			fmt.Fprintf(u.stdout, "Attempt %d of %d failed - %s. Retrying in %s\n", attempt-1, attempts, lastErr, backoff)
+			sleep(backoff)
+		}
+
+		var offset int64
+		if u.resumable && attempt > 1 {
+			offset = u.uploadedSize(url, headers, size)
+		}
+
+		status, body, err := u.send(f, url, headers, offset, size)
+		if err == nil && offset != 0 && !u.expected(status) && !retryableStatus(status) {
+			// The server does not support resuming so upload the whole file
+			fmt.Fprintf(u.stdout, "Unable to resume upload - received %d response. Uploading the whole file\n", status)
+			status, body, err = u.send(f, url, headers, 0, size)
+		}
+
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if u.expected(status) {
+			return nil
+		}
+
+		lastErr = fmt.Errorf("Received %d response - %s", status, body)
+		if !retryableStatus(status) {
+			return lastErr
+		}
+	}
+
+	return lastErr
+}
+
+func (u *httpUploader) send(f *os.File, url string, headers map[string]string, offset int64, size int64) (int, []byte, error) {
+	req, err := http.NewRequest(u.method, url, io.NewSectionReader(f, offset, size-offset))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.ContentLength = size - offset
+
+	if offset != 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size))
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	u.authenticate(req)
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	return res.StatusCode, body, err
+}
+
+// uploadedSize asks the server how much of a file it has received using the
+// Content-Range query of resumable uploads. Only a server which supports them
+// replies 308 with the Range received, otherwise 0 is returned and the whole
+// file is uploaded again.
+func (u *httpUploader) uploadedSize(url string, headers map[string]string, size int64) int64 {
+	req, err := http.NewRequest("PUT", url, nil)
+	if err != nil {
+		return 0
+	}
+	req.ContentLength = 0
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	u.authenticate(req)
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return 0
+	}
+	res.Body.Close()
+
+	if res.StatusCode != statusResumeIncomplete {
+		return 0
+	}
+
+	var start, end int64
+	if n, err := fmt.Sscanf(res.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil || n != 2 || start != 0 || end+1 >= size {
+		return 0
+	}
+
+	return end + 1
+}
+
+func (u *httpUploader) authenticate(req *http.Request) {
+	if len(u.token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	} else if len(u.username) != 0 {
+		req.SetBasicAuth(u.username, u.password)
+	}
+}
+
+func (u *httpUploader) expected(status int) bool {
+	for _, s := range u.expectedStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func retryableStatus(status int) bool {
+	return status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
@@ -0,0 +1,294 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRepository struct {
+	files     map[string][]byte
+	requests  []*http.Request
+	responses []int
+	// resumable repositories reply to Content-Range queries and append ranges
+	// to partial uploads. Others store the body of every PUT as the file.
+	resumable bool
+}
+
+func newFakeRepository() (*fakeRepository, *httptest.Server) {
+	repo := &fakeRepository{files: make(map[string][]byte)}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo.requests = append(repo.requests, r)
+		body, _ := ioutil.ReadAll(r.Body)
+
+		contentRange := r.Header.Get("Content-Range")
+		if repo.resumable && strings.HasPrefix(contentRange, "bytes */") {
+			if d := repo.files[r.URL.Path]; len(d) != 0 {
+				w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(d)-1))
+			}
+			w.WriteHeader(statusResumeIncomplete)
+			return
+		}
+
+		status := http.StatusCreated
+		if len(repo.responses) != 0 {
+			status, repo.responses = repo.responses[0], repo.responses[1:]
+		}
+
+		if repo.resumable && contentRange != "" {
+			repo.files[r.URL.Path] = append(repo.files[r.URL.Path], body...)
+		} else if status == http.StatusInternalServerError {
+			// A partial upload
+			repo.files[r.URL.Path] = body[:len(body)/2]
+		} else {
+			repo.files[r.URL.Path] = body
+		}
+
+		w.WriteHeader(status)
+	}))
+
+	return repo, server
+}
+
+func stubSleep() func() {
+	sleep = func(time.Duration) {}
+	return func() { sleep = time.Sleep }
+}
+
+func TestHttpDestination_Parse(t *testing.T) {
+	publishHcl := `
+publish example {
+	destination http {
+		url_template = "https://nexus.lab/repository/releases/{{.Project.Version}}/{{.File}}"
+		method = "post"
+		expected_status = [200]
+		headers {
+			X-Checksum-Sha256 = "{{sha256file .Path}}"
+		}
+		auth {
+			type = "basic"
+			username = "ci"
+		}
+		retry {
+			attempts = 3
+			backoff = "1s"
+		}
+	}
+	files = ["/path/to/files"]
+}
+`
+	ast, err := extractObject(publishHcl)
+	if assert.Nil(t, err) {
+		step, err := (&PublishParser{}).Parse(ast)
+		if assert.Nil(t, err) {
+			assert.Equal(t, &httpPublishDestination{
+				UrlTemplate:    "https://nexus.lab/repository/releases/{{.Project.Version}}/{{.File}}",
+				Method:         "POST",
+				ExpectedStatus: []int{200},
+				Headers:        map[string]string{"X-Checksum-Sha256": "{{sha256file .Path}}"},
+				Auth:           HttpAuth{Type: "basic", Username: "ci"},
+				Retry:          Retry{Attempts: 3, Backoff: "1s"},
+			}, step.(PublishStep).Destinations[0])
+		}
+	}
+}
+
+func TestHttpDestination_ParseValidates(t *testing.T) {
+	tests := map[string]string{
+		`method = "DELETE"`:                      "The http destination method must be PUT or POST - was DELETE",
+		`method = "POST" resumable = true`:       "Only PUT uploads to an http destination can be resumable",
+		`auth { type = "digest" }`:               "Unknown auth type digest. Available options basic, bearer",
+		`auth { type = "bearer" }`:               "Bearer auth must specify token",
+		`retry { attempts = 0 }`:                 "Retry attempts must be at least 1 - was 0",
+		`headers { Accept = "*/*" } verbose = 1`: "Unknown attribute verbose in http destination",
+	}
+
+	for attributes, issue := range tests {
+		publishHcl := fmt.Sprintf(`
+publish example {
+	destination http {
+		url_template = "http://localhost/{{.File}}"
+		%s
+	}
+	files = ["/path/to/files"]
+}
+`, attributes)
+		ast, err := extractObject(publishHcl)
+		if assert.Nil(t, err, attributes) {
+			_, err := (&PublishParser{}).Parse(ast)
+			assert.Equal(t, &ConfigError{Issues: []string{issue}}, err, attributes)
+		}
+	}
+}
+
+func TestHttpDestination_ExecuteRetries(t *testing.T) {
+	assert := assert.New(t)
+	defer stubSleep()()
+
+	repo, server := newFakeRepository()
+	defer server.Close()
+	repo.responses = []int{http.StatusServiceUnavailable, http.StatusOK}
+
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "cimple.tar.gz")
+	ioutil.WriteFile(src, []byte("hello"), 0644)
+
+	destination := httpPublishDestination{
+		UrlTemplate:    server.URL + "/releases/{{.Project.Version}}/{{.File}}",
+		Method:         "PUT",
+		ExpectedStatus: []int{http.StatusOK},
+		Headers:        map[string]string{"X-Version": "{{.Project.Version}}"},
+		Auth:           HttpAuth{Type: "basic", Username: "ci"},
+		Retry:          Retry{Attempts: 2, Backoff: "1s"},
+	}
+	vars := StepVars{
+		Project: Project{Version: "1.0.0"},
+		Secrets: &fakeSecretStore{secrets: map[string]string{"http:ci": "pa55"}},
+	}
+
+	var out bytes.Buffer
+	err := destination.Execute([]string{src}, vars, &out, &out)
+	if assert.Nil(err) {
+		assert.Equal("hello", string(repo.files["/releases/1.0.0/cimple.tar.gz"]))
+		assert.Equal(2, len(repo.requests))
+		username, password, _ := repo.requests[1].BasicAuth()
+		assert.Equal("ci", username)
+		assert.Equal("pa55", password)
+		assert.Equal("1.0.0", repo.requests[1].Header.Get("X-Version"))
+		assert.Contains(out.String(), "Attempt 1 of 2 failed - Received 503 response - . Retrying in 1s")
+	}
+}
+
+func TestHttpDestination_ExecuteUnexpectedStatus(t *testing.T) {
+	defer stubSleep()()
+
+	repo, server := newFakeRepository()
+	defer server.Close()
+	repo.responses = []int{http.StatusUnauthorized}
+
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "cimple.tar.gz")
+	ioutil.WriteFile(src, []byte("hello"), 0644)
+
+	destination := httpPublishDestination{
+		UrlTemplate:    server.URL + "/{{.File}}",
+		Method:         "PUT",
+		ExpectedStatus: defaultExpectedStatus,
+		Auth:           HttpAuth{Type: "bearer", Token: "nexus"},
+		Retry:          Retry{Attempts: 3},
+	}
+	vars := StepVars{Secrets: &fakeSecretStore{secrets: map[string]string{"http:nexus": "t0ken"}}}
+
+	var out bytes.Buffer
+	err := destination.Execute([]string{src}, vars, &out, &out)
+	assert.EqualError(t, err, "Failed to publish "+src+" - Received 401 response - ")
+	assert.Equal(t, 1, len(repo.requests))
+	assert.Equal(t, "Bearer t0ken", repo.requests[0].Header.Get("Authorization"))
+}
+
+func TestHttpDestination_ExecuteResumes(t *testing.T) {
+	assert := assert.New(t)
+	defer stubSleep()()
+
+	repo, server := newFakeRepository()
+	defer server.Close()
+	repo.resumable = true
+	repo.responses = []int{http.StatusInternalServerError}
+
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "cimple.deb")
+	ioutil.WriteFile(src, []byte("0123456789"), 0644)
+
+	destination := httpPublishDestination{
+		UrlTemplate:    server.URL + "/{{.File}}",
+		Method:         "PUT",
+		ExpectedStatus: defaultExpectedStatus,
+		Resumable:      true,
+		Retry:          Retry{Attempts: 2},
+	}
+
+	var out bytes.Buffer
+	err := destination.Execute([]string{src}, StepVars{}, &out, &out)
+	if assert.Nil(err) {
+		assert.Equal("0123456789", string(repo.files["/cimple.deb"]))
+		assert.Equal(3, len(repo.requests))
+		assert.Equal("bytes */10", repo.requests[1].Header.Get("Content-Range"))
+		assert.Equal("bytes 5-9/10", repo.requests[2].Header.Get("Content-Range"))
+	}
+}
+
+func TestHttpDestination_ExecuteUploadsWholeFileWhenResumingIsUnsupported(t *testing.T) {
+	assert := assert.New(t)
+	defer stubSleep()()
+
+	repo, server := newFakeRepository()
+	defer server.Close()
+	repo.responses = []int{http.StatusInternalServerError}
+	// An older release at the same url
+	repo.files["/cimple.deb"] = []byte("01234")
+
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "cimple.deb")
+	ioutil.WriteFile(src, []byte("0123456789"), 0644)
+
+	destination := httpPublishDestination{
+		UrlTemplate:    server.URL + "/{{.File}}",
+		Method:         "PUT",
+		ExpectedStatus: defaultExpectedStatus,
+		Resumable:      true,
+		Retry:          Retry{Attempts: 2},
+	}
+
+	var out bytes.Buffer
+	err := destination.Execute([]string{src}, StepVars{}, &out, &out)
+	if assert.Nil(err) {
+		assert.Equal("0123456789", string(repo.files["/cimple.deb"]))
+		for _, r := range repo.requests {
+			assert.NotEqual("bytes 5-9/10", r.Header.Get("Content-Range"))
+		}
+	}
+}
+
+func TestBintrayDestination_Execute(t *testing.T) {
+	assert := assert.New(t)
+
+	repo, server := newFakeRepository()
+	defer server.Close()
+	repo.responses = []int{http.StatusOK, http.StatusCreated}
+	bintrayApiUrl = server.URL
+	defer func() { bintrayApiUrl = "https://api.bintray.com" }()
+
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+	files := []string{filepath.Join(dir, "a.tar.gz"), filepath.Join(dir, "b.tar.gz")}
+	for _, f := range files {
+		ioutil.WriteFile(f, []byte(filepath.Base(f)), 0644)
+	}
+
+	destination := bintrayPublishDestination{Subject: "cimpleci", Repository: "pkgs", Package: "cimple", Username: "lukesmith"}
+	vars := StepVars{
+		Project: Project{Version: "1.0.0"},
+		Secrets: &fakeSecretStore{secrets: map[string]string{"bintray:lukesmith": "pa55"}},
+	}
+
+	var out bytes.Buffer
+	err := destination.Execute(files, vars, &out, &out)
+	if assert.Nil(err) {
+		assert.Equal("a.tar.gz", string(repo.files["/content/cimpleci/pkgs/cimple/1.0.0/a.tar.gz"]))
+		assert.Equal("b.tar.gz", string(repo.files["/content/cimpleci/pkgs/cimple/1.0.0/b.tar.gz"]))
+	}
+}
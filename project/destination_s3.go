@@ -0,0 +1,461 @@
+package project
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+const (
+	defaultS3Region   = "us-east-1"
+	defaultS3PartSize = 16
+	minS3PartSize     = 5
+	megabyte          = 1024 * 1024
+)
+
+// contentTypes are used for extensions commonly published which are not
+// known to the mime package.
+var contentTypes = map[string]string{
+	".deb": "application/vnd.debian.binary-package",
+	".gz":  "application/gzip",
+	".rpm": "application/x-rpm",
+	".tar": "application/x-tar",
+	".tgz": "application/gzip",
+	".zip": "application/zip",
+}
+
+// s3PublishDestination uploads files to an S3 compatible object store. The
+// secret key is retrieved from the secret store as the s3 secret of the
+// access key.
+type s3PublishDestination struct {
+	Bucket    string
+	Prefix    string
+	Endpoint  string
+	Region    string
+	AccessKey string `mapstructure:"access_key"`
+	// PartSize is the size in megabytes of each part of a multipart upload.
+	// Files larger than a part are uploaded in parts.
+	PartSize int `mapstructure:"part_size"`
+}
+
+func parseS3Destination(item *ast.ObjectItem) (PublishDestination, error) {
+	destination := &s3PublishDestination{}
+	if err := DecodeDestination(item, destination); err != nil {
+		return nil, err
+	}
+
+	if err := requireAttributes("s3", map[string]string{
+		"bucket":     destination.Bucket,
+		"access_key": destination.AccessKey,
+	}); err != nil {
+		return nil, err
+	}
+
+	if destination.PartSize != 0 && destination.PartSize < minS3PartSize {
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("The s3 destination part_size must be at least %d", minS3PartSize)},
+		}
+	}
+
+	if len(destination.Endpoint) != 0 {
+		if u, err := url.Parse(destination.Endpoint); err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return nil, &ConfigError{
+				Issues: []string{fmt.Sprintf("The s3 destination endpoint %s must be a url", destination.Endpoint)},
+			}
+		}
+	}
+
+	return destination, nil
+}
+
+func (d s3PublishDestination) Execute(files []string, vars StepVars, stdout io.Writer, stderr io.Writer) error {
+	if vars.Secrets == nil {
+		return fmt.Errorf("No secrets are available to retrieve the s3 secret key for %s", d.AccessKey)
+	}
+
+	secretKey, err := vars.Secrets.Get("s3", d.AccessKey)
+	if err != nil {
+		return err
+	}
+
+	keys, err := d.keys(files, vars)
+	if err != nil {
+		return err
+	}
+
+	client := &s3Client{
+		endpoint:  d.Endpoint,
+		bucket:    d.Bucket,
+		region:    d.Region,
+		accessKey: d.AccessKey,
+		secretKey: secretKey,
+		http:      &http.Client{},
+		now:       time.Now,
+	}
+	if len(client.region) == 0 {
+		client.region = defaultS3Region
+	}
+
+	partSize := int64(d.PartSize) * megabyte
+	if partSize == 0 {
+		partSize = defaultS3PartSize * megabyte
+	}
+
+	for i, f := range files {
+		fmt.Fprintf(stdout, "Publishing %s to s3://%s/%s\n", f, d.Bucket, keys[i])
+
+		if err := client.upload(f, keys[i], partSize); err != nil {
+			return fmt.Errorf("Failed to publish %s - %s", f, err)
+		}
+	}
+
+	return nil
+}
+
+func (d s3PublishDestination) Targets(files []string, vars StepVars) ([]string, error) {
+	keys, err := d.keys(files, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []string{}
+	for _, k := range keys {
+		targets = append(targets, fmt.Sprintf("s3://%s/%s", d.Bucket, k))
+	}
+	return targets, nil
+}
+
+// keys returns the object key of each file, within the prefix.
+func (d s3PublishDestination) keys(files []string, vars StepVars) ([]string, error) {
+	prefix, err := renderTemplate("destination.prefix", d.Prefix, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, f := range files {
+		keys = append(keys, path.Join(strings.Trim(prefix, "/"), filepath.Base(f)))
+	}
+	return keys, nil
+}
+
+func contentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+
+	if t := mime.TypeByExtension(ext); len(t) != 0 {
+		return t
+	}
+
+	return "application/octet-stream"
+}
+
+type s3Client struct {
+	endpoint  string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	http      *http.Client
+	now       func() time.Time
+}
+
+// objectUrl returns the url of an object. Path style urls are used with a
+// custom endpoint as these are supported by S3 compatible stores.
+func (c *s3Client) objectUrl(key string) string {
+	if len(c.endpoint) == 0 {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", c.bucket, c.region, key)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", strings.TrimRight(c.endpoint, "/"), c.bucket, key)
+}
+
+func (c *s3Client) upload(file string, key string, partSize int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+
+	headers := map[string]string{
+		"Content-Type":      contentType(file),
+		"X-Amz-Meta-Sha256": hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	if info.Size() <= partSize {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.do("PUT", key, nil, headers, body)
+		return err
+	}
+
+	return c.multipartUpload(f, key, info.Size(), partSize, headers)
+}
+
+type initiateMultipartUploadResult struct {
+	UploadId string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+func (c *s3Client) multipartUpload(f *os.File, key string, size int64, partSize int64, headers map[string]string) error {
+	res, err := c.do("POST", key, url.Values{"uploads": {""}}, headers, nil)
+	if err != nil {
+		return err
+	}
+
+	var initiated initiateMultipartUploadResult
+	if err := xml.Unmarshal(res, &initiated); err != nil || len(initiated.UploadId) == 0 {
+		return fmt.Errorf("Unable to start multipart upload - %s", res)
+	}
+	uploadId := initiated.UploadId
+
+	complete := completeMultipartUpload{}
+	buf := make([]byte, partSize)
+	for part, offset := 1, int64(0); offset < size; part, offset = part+1, offset+partSize {
+		n, err := f.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			c.abort(key, uploadId)
+			return err
+		}
+
+		query := url.Values{
+			"partNumber": {fmt.Sprintf("%d", part)},
+			"uploadId":   {uploadId},
+		}
+		etag, err := c.doPart(key, query, buf[:n])
+		if err != nil {
+			c.abort(key, uploadId)
+			return fmt.Errorf("Unable to upload part %d - %s", part, err)
+		}
+
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: part, ETag: etag})
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		c.abort(key, uploadId)
+		return err
+	}
+
+	if _, err := c.do("POST", key, url.Values{"uploadId": {uploadId}}, map[string]string{"Content-Type": "application/xml"}, body); err != nil {
+		c.abort(key, uploadId)
+		return err
+	}
+
+	return nil
+}
+
+func (c *s3Client) doPart(key string, query url.Values, body []byte) (string, error) {
+	req, err := c.newRequest("PUT", key, query, nil, body)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		d, _ := ioutil.ReadAll(res.Body)
+		return "", fmt.Errorf("Received %d response - %s", res.StatusCode, d)
+	}
+
+	return res.Header.Get("ETag"), nil
+}
+
+func (c *s3Client) abort(key string, uploadId string) {
+	c.do("DELETE", key, url.Values{"uploadId": {uploadId}}, nil, nil)
+}
+
+func (c *s3Client) do(method string, key string, query url.Values, headers map[string]string, body []byte) ([]byte, error) {
+	req, err := c.newRequest(method, key, query, headers, body)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	d, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("Received %d response - %s", res.StatusCode, d)
+	}
+
+	return d, nil
+}
+
+func (c *s3Client) newRequest(method string, key string, query url.Values, headers map[string]string, body []byte) (*http.Request, error) {
+	u := c.objectUrl(s3EscapePath(key))
+	if len(query) != 0 {
+		u = u + "?" + s3CanonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if len(body) != 0 {
+		sum := md5.Sum(body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+
+	payloadHash := sha256.Sum256(body)
+	signS3Request(req, hex.EncodeToString(payloadHash[:]), c.accessKey, c.secretKey, c.region, c.now())
+
+	return req, nil
+}
+
+// signS3Request signs the request with AWS signature version 4.
+func signS3Request(req *http.Request, payloadHash string, accessKey string, secretKey string, region string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	names := []string{}
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, v := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSha256(key, v)
+	}
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape encodes everything except the characters AWS leaves unreserved.
+func s3Escape(s string) string {
+	var b bytes.Buffer
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = s3Escape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := []string{}
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,194 @@
+package project
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/lukesmith/cimple/vcs/git"
+	"github.com/mitchellh/mapstructure"
+)
+
+type include struct {
+	name     string
+	Path     string
+	Git      string
+	Revision string
+}
+
+func parseInclude(item *ast.ObjectItem) (*include, error) {
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return nil, err
+	}
+
+	inc := &include{}
+	if err := mapstructure.WeakDecode(m, inc); err != nil {
+		return nil, err
+	}
+
+	if len(item.Keys) > 0 {
+		inc.name = item.Keys[0].Token.Value().(string)
+	}
+
+	if len(inc.Path) == 0 {
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("Include %s must specify a path", inc.name)},
+		}
+	}
+
+	if len(inc.Git) != 0 && len(inc.Revision) == 0 {
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("Include %s must pin a revision of %s", inc.name, inc.Git)},
+		}
+	}
+
+	return inc, nil
+}
+
+// resolve returns the location of the included file, fetching it from git
+// when required.
+func (inc *include) resolve(dir string) (string, error) {
+	if len(inc.Git) == 0 {
+		if filepath.IsAbs(inc.Path) {
+			return inc.Path, nil
+		}
+		return filepath.Join(dir, inc.Path), nil
+	}
+
+	repoDir, err := fetchGitInclude(inc.Git, inc.Revision, dir)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(repoDir, inc.Path), nil
+}
+
+var fetchGitInclude = func(url string, revision string, dir string) (string, error) {
+	key := fmt.Sprintf("%x", sha256.Sum256([]byte(url+"@"+revision)))
+	repoDir := filepath.Join(dir, ".cimple", ".includes", key[:16])
+
+	if _, err := os.Stat(repoDir); err == nil {
+		return repoDir, nil
+	}
+
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		return "", err
+	}
+
+	if err := git.Clone(git.NewCloneOptions(url, repoDir), ioutil.Discard); err != nil {
+		os.RemoveAll(repoDir)
+		return "", fmt.Errorf("Unable to clone include %s - %s", url, err)
+	}
+
+	if err := git.Checkout(git.NewCheckoutOptions(repoDir, revision), ioutil.Discard); err != nil {
+		os.RemoveAll(repoDir)
+		return "", fmt.Errorf("Unable to checkout revision %s of include %s - %s", revision, url, err)
+	}
+
+	return repoDir, nil
+}
+
+func loadInclude(inc *include, dir string, visited map[string]bool) (map[string]*Task, map[string]string, error) {
+	path, err := inc.resolve(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if visited[path] {
+		return nil, nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("Include %s is included recursively", path)},
+		}
+	}
+
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj, err := hcl.Parse(string(d))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to parse include %s - %s", path, err)
+	}
+
+	list, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, nil, fmt.Errorf("Node is not an ObjectList")
+	}
+
+	if _, err := migrateSchema(list); err != nil {
+		return nil, nil, includeError(path, err)
+	}
+
+	visited[path] = true
+	defer delete(visited, path)
+
+	return parseTasksAndEnv(list, filepath.Dir(path), visited)
+}
+
+// includeError reports an error loading an include against its path.
+func includeError(path string, err error) error {
+	configErr, ok := err.(*ConfigError)
+	if !ok {
+		return fmt.Errorf("Unable to load include %s - %s", path, err)
+	}
+
+	issues := []string{}
+	for _, issue := range configErr.Issues {
+		issues = append(issues, fmt.Sprintf("Include %s - %s", path, issue))
+	}
+	return &ConfigError{Issues: issues}
+}
+
+// mergeTasks adds the tasks from one configuration into another. A task in
+// from may only replace an existing task when it is marked as an override.
+func mergeTasks(into map[string]*Task, from map[string]*Task, source string) []string {
+	issues := []string{}
+	checked := make(map[string]bool)
+
+	for _, task := range from {
+		name := task.Name
+		if len(task.BaseName) != 0 {
+			name = task.BaseName
+		}
+
+		if checked[name] {
+			continue
+		}
+		checked[name] = true
+
+		if !taskExists(into, name) {
+			continue
+		}
+
+		if !task.Override {
+			issues = append(issues, fmt.Sprintf("A task named %s exists multiple times. It is defined in %s", name, source))
+			continue
+		}
+
+		for k, t := range into {
+			if t.Name == name || t.BaseName == name {
+				delete(into, k)
+			}
+		}
+	}
+
+	if len(issues) != 0 {
+		return issues
+	}
+
+	for k, task := range from {
+		into[k] = task
+	}
+
+	return issues
+}
@@ -0,0 +1,477 @@
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// RunContexts are the contexts a build can be run within.
+var RunContexts = []string{"local", "server"}
+
+// LintIssue is a problem found within a configuration file.
+type LintIssue struct {
+	Pos     token.Pos
+	Message string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Pos, i.Message)
+}
+
+type lintTask struct {
+	name     string
+	filename string
+	item     *ast.ObjectItem
+	depends  []*ast.LiteralType
+}
+
+type linter struct {
+	issues  []LintIssue
+	tasks   map[string]*lintTask
+	visited map[string]bool
+}
+
+// Lint checks the configuration at path, along with any configurations it
+// includes, returning every issue found rather than stopping at the first.
+func Lint(path string) ([]LintIssue, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{
+		issues:  []LintIssue{},
+		tasks:   make(map[string]*lintTask),
+		visited: make(map[string]bool),
+	}
+
+	if err := l.lintFile(path, true); err != nil {
+		return nil, err
+	}
+
+	l.lintDependencies()
+
+	sort.Stable(byPosition(l.issues))
+
+	return l.issues, nil
+}
+
+// byPosition orders issues by file, line and column.
+type byPosition []LintIssue
+
+func (p byPosition) Len() int      { return len(p) }
+func (p byPosition) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byPosition) Less(i, j int) bool {
+	a, b := p[i].Pos, p[j].Pos
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+func (l *linter) report(filename string, pos token.Pos, format string, args ...interface{}) {
+	pos.Filename = filename
+	l.issues = append(l.issues, LintIssue{
+		Pos:     pos,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) reportError(filename string, pos token.Pos, err error) {
+	if ce, ok := err.(*ConfigError); ok {
+		for _, issue := range ce.Issues {
+			l.report(filename, pos, "%s", issue)
+		}
+		return
+	}
+
+	l.report(filename, pos, "%s", err)
+}
+
+func (l *linter) lintFile(path string, root bool) error {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	l.visited[path] = true
+	defer delete(l.visited, path)
+
+	obj, err := hcl.Parse(string(d))
+	if err != nil {
+		if pe, ok := err.(*parser.PosError); ok {
+			l.report(path, pe.Pos, "%s", pe.Err)
+		} else {
+			l.report(path, token.Pos{}, "%s", err)
+		}
+		return nil
+	}
+
+	list, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		l.report(path, obj.Pos(), "Node is not an ObjectList")
+		return nil
+	}
+
+	if _, err := migrateSchema(list); err != nil {
+		pos := list.Pos()
+		if blocks := list.Filter("cimple").Items; len(blocks) > 0 {
+			pos = blocks[0].Val.Pos()
+		}
+		l.reportError(path, pos, err)
+	}
+
+	if root {
+		l.lintProject(path, list)
+	}
+
+	for _, item := range list.Filter("include").Items {
+		l.lintInclude(path, item)
+	}
+
+	for _, item := range list.Filter("env").Items {
+		l.lintTemplates(path, item.Val)
+	}
+
+	for _, item := range list.Filter("task").Items {
+		l.lintTask(path, item)
+	}
+
+	return nil
+}
+
+func (l *linter) lintProject(path string, list *ast.ObjectList) {
+	for _, fieldName := range []string{"name", "version"} {
+		if len(list.Filter(fieldName).Items) == 0 {
+			l.report(path, list.Pos(), "'%s' was not specified", fieldName)
+		}
+	}
+}
+
+func (l *linter) lintInclude(path string, item *ast.ObjectItem) {
+	inc, err := parseInclude(item)
+	if err != nil {
+		l.reportError(path, item.Val.Pos(), err)
+		return
+	}
+
+	target, err := inc.resolve(filepath.Dir(path))
+	if err == nil {
+		target, err = filepath.Abs(target)
+	}
+	if err != nil {
+		l.reportError(path, item.Val.Pos(), err)
+		return
+	}
+
+	if l.visited[target] {
+		l.report(path, item.Val.Pos(), "Include %s is included recursively", target)
+		return
+	}
+
+	if err := l.lintFile(target, false); err != nil {
+		l.report(path, item.Val.Pos(), "Unable to read include %s - %s", inc.name, err)
+	}
+}
+
+func (l *linter) lintTask(path string, item *ast.ObjectItem) {
+	if len(item.Keys) == 0 {
+		l.report(path, item.Val.Pos(), "A task must have a name")
+		return
+	}
+
+	name := item.Keys[0].Token.Value().(string)
+	if !validName.MatchString(name) {
+		l.report(path, item.Pos(), "%s is not a valid task name", name)
+	}
+
+	ot, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		l.report(path, item.Val.Pos(), "Task %s must be a block", name)
+		return
+	}
+
+	override := false
+	for _, attr := range ot.List.Filter("override").Items {
+		if lit, ok := attr.Val.(*ast.LiteralType); ok && lit.Token.Type == token.BOOL {
+			override = lit.Token.Value().(bool)
+		}
+	}
+
+	if existing, ok := l.tasks[name]; ok && !override {
+		l.report(path, item.Pos(), "A task named %s exists multiple times. It is also defined at %s:%d", name, existing.filename, existing.item.Pos().Line)
+	}
+
+	task := &lintTask{
+		name:     name,
+		filename: path,
+		item:     item,
+	}
+	l.tasks[name] = task
+
+	for _, attr := range ot.List.Items {
+		if len(attr.Keys) == 0 {
+			continue
+		}
+
+		switch attr.Keys[0].Token.Value() {
+		case "depends":
+			list, ok := attr.Val.(*ast.ListType)
+			if !ok {
+				l.report(path, attr.Val.Pos(), "depends must be a list of task names")
+				continue
+			}
+			for _, n := range list.List {
+				if lit, ok := n.(*ast.LiteralType); ok && lit.Token.Type == token.STRING {
+					task.depends = append(task.depends, lit)
+				} else {
+					l.report(path, n.Pos(), "depends must be a list of task names")
+				}
+			}
+		case "limit_to":
+			l.lintLimitTo(path, attr)
+		case "when":
+			l.lintCondition(path, attr)
+		case "matrix":
+			if _, err := parseMatrix(&ast.ObjectList{Items: []*ast.ObjectItem{attr}}); err != nil {
+				l.reportError(path, attr.Val.Pos(), err)
+			}
+		case "env", "cache":
+			l.lintTemplates(path, attr.Val)
+		}
+	}
+
+	if _, err := parseParams(ot.List.Filter("param")); err != nil {
+		l.reportError(path, item.Val.Pos(), err)
+	}
+
+	if _, err := parseServices(ot.List.Filter("service")); err != nil {
+		l.reportError(path, item.Val.Pos(), err)
+	}
+
+	if _, err := parseCaches(ot.List.Filter("cache")); err != nil {
+		l.reportError(path, item.Val.Pos(), err)
+	}
+
+	stepNames := make(map[string]bool)
+	for _, sp := range stepParsers {
+		for _, stepItem := range ot.List.Filter(sp.GetToken()).Items {
+			l.lintStep(path, name, sp, stepItem, stepNames)
+		}
+	}
+
+	finally := ot.List.Filter("finally").Items
+	if len(finally) > 1 {
+		l.report(path, finally[1].Pos(), "Task %s can only contain a single finally block", name)
+	}
+
+	for _, f := range finally {
+		fot, ok := f.Val.(*ast.ObjectType)
+		if !ok {
+			l.report(path, f.Val.Pos(), "finally in task %s must be a block of steps", name)
+			continue
+		}
+
+		for _, sp := range stepParsers {
+			for _, stepItem := range fot.List.Filter(sp.GetToken()).Items {
+				l.lintStep(path, name, sp, stepItem, stepNames)
+			}
+		}
+	}
+}
+
+func (l *linter) lintLimitTo(path string, attr *ast.ObjectItem) {
+	lit, ok := attr.Val.(*ast.LiteralType)
+	if !ok || lit.Token.Type != token.STRING {
+		l.report(path, attr.Val.Pos(), "limit_to must be a string")
+		return
+	}
+
+	value := lit.Token.Value().(string)
+	for _, rc := range RunContexts {
+		if rc == value {
+			return
+		}
+	}
+
+	l.report(path, lit.Pos(), "%s is not a known run context. Available options %s", value, strings.Join(RunContexts, ", "))
+}
+
+func (l *linter) lintStep(path string, taskName string, sp StepParser, item *ast.ObjectItem, names map[string]bool) {
+	if len(item.Keys) == 0 {
+		l.report(path, item.Val.Pos(), "A %s step in task %s must have a name", sp.GetToken(), taskName)
+		return
+	}
+
+	name := item.Keys[0].Token.Value().(string)
+	if !validName.MatchString(name) {
+		l.report(path, item.Pos(), "%s is not a valid step name", name)
+	}
+
+	if names[name] {
+		l.report(path, item.Pos(), "A step named %s exists multiple times in task %s", name, taskName)
+	}
+	names[name] = true
+
+	ot, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		l.report(path, item.Val.Pos(), "Step %s must be a block", name)
+		return
+	}
+
+	if _, ok := sp.(*ParallelStepParser); ok {
+		// The steps of a parallel step are linted as steps of the task
+		for _, msp := range parallelStepParsers {
+			for _, member := range ot.List.Filter(msp.GetToken()).Items {
+				l.lintStep(path, taskName, msp, member, names)
+			}
+		}
+	} else if _, err := sp.Parse(item); err != nil {
+		l.reportError(path, item.Val.Pos(), err)
+	}
+
+	allowed := make(map[string]bool)
+	for _, a := range sp.GetAttributes() {
+		allowed[a] = true
+	}
+
+	for _, attr := range ot.List.Items {
+		if len(attr.Keys) == 0 {
+			continue
+		}
+
+		key := fmt.Sprintf("%v", attr.Keys[0].Token.Value())
+		if !allowed[key] {
+			l.report(path, attr.Pos(), "Unknown attribute %s in %s step %s", key, sp.GetToken(), name)
+			continue
+		}
+
+		if _, ok := sp.(*ParallelStepParser); ok && isParallelStepToken(key) {
+			continue
+		}
+
+		if key == "when" {
+			l.lintCondition(path, attr)
+		} else {
+			l.lintTemplates(path, attr.Val)
+		}
+	}
+}
+
+func (l *linter) lintCondition(path string, attr *ast.ObjectItem) {
+	lit, ok := attr.Val.(*ast.LiteralType)
+	if !ok || lit.Token.Type != token.STRING {
+		l.report(path, attr.Val.Pos(), "when must be a string")
+		return
+	}
+
+	if _, err := parseTemplate("when", conditionTemplate(lit.Token.Value().(string)), StepVars{}); err != nil {
+		l.report(path, lit.Pos(), "Unable to parse condition - %s", err)
+	}
+}
+
+// lintTemplates checks every string within node can be parsed as a template.
+func (l *linter) lintTemplates(path string, node ast.Node) {
+	ast.Walk(node, func(n ast.Node) (ast.Node, bool) {
+		lit, ok := n.(*ast.LiteralType)
+		if ok && (lit.Token.Type == token.STRING || lit.Token.Type == token.HEREDOC) {
+			if _, err := parseTemplate("t", lit.Token.Value().(string), StepVars{}); err != nil {
+				l.report(path, lit.Pos(), "Unable to parse template - %s", err)
+			}
+		}
+		return n, true
+	})
+}
+
+func (l *linter) lintDependencies() {
+	names := []string{}
+	for name := range l.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// resolved maps each task to the tasks its depends entries refer to.
+	resolved := make(map[string][]string)
+	for _, name := range names {
+		task := l.tasks[name]
+		for _, lit := range task.depends {
+			dep := lit.Token.Value().(string)
+			base, _, err := ParseTaskSelector(dep)
+			if err != nil {
+				l.report(task.filename, lit.Pos(), "%s", err)
+				resolved[name] = append(resolved[name], "")
+				continue
+			}
+
+			if _, ok := l.tasks[base]; !ok {
+				l.report(task.filename, lit.Pos(), "Task %s depends on unknown task %s", name, dep)
+				resolved[name] = append(resolved[name], "")
+				continue
+			}
+
+			resolved[name] = append(resolved[name], base)
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	stack := []string{}
+	reported := make(map[string]bool)
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+
+		task := l.tasks[name]
+		for i, dep := range resolved[name] {
+			if len(dep) == 0 {
+				continue
+			}
+
+			switch state[dep] {
+			case 0:
+				visit(dep)
+			case visiting:
+				start := 0
+				for j, s := range stack {
+					if s == dep {
+						start = j
+					}
+				}
+				cycle := append(append([]string{}, stack[start:]...), dep)
+
+				members := append([]string{}, stack[start:]...)
+				sort.Strings(members)
+				key := strings.Join(members, ",")
+				if !reported[key] {
+					reported[key] = true
+					l.report(task.filename, task.depends[i].Pos(), "Dependency cycle %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+	}
+
+	for _, name := range names {
+		if state[name] == 0 {
+			visit(name)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package project
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLint_ReportsEveryIssue(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join("./test-fixtures", "lint.hcl")
+	issues, err := Lint(path)
+	if !assert.Nil(err) {
+		return
+	}
+
+	actual := []string{}
+	for _, issue := range issues {
+		// Template parse errors vary between go versions.
+		message := issue.String()
+		if i := strings.Index(message, "unexpected"); i != -1 {
+			message = message[:i+len("unexpected")]
+		}
+		actual = append(actual, message)
+	}
+
+	abs, _ := filepath.Abs(path)
+	assert.Equal([]string{
+		abs + ":9:14: Task build depends on unknown task missing",
+		abs + ":10:14: cloud is not a known run context. Available options local, server",
+		abs + ":13:12: Unable to parse template - template: t:1: unclosed action",
+		abs + ":14:5: Unknown attribute shell in script step compile",
+		abs + ":17:11: Bad is not a valid step name",
+		abs + ":23:14: Dependency cycle build -> test -> build",
+		abs + ":24:10: Unable to parse condition - template: when:1: unexpected",
+		abs + ":26:15: Timeout soon is not a valid duration",
+		abs + ":33:5: Unknown attribute fail_fast in parallel step checks",
+		abs + ":35:13: A step named vet exists multiple times in task test",
+		abs + ":35:17: Timeout later is not a valid duration",
+	}, actual)
+}
+
+func TestLint_ValidConfiguration(t *testing.T) {
+	issues, err := Lint(filepath.Join("./test-fixtures", "basic.hcl"))
+	if assert.Nil(t, err) {
+		assert.Empty(t, issues)
+	}
+}
@@ -0,0 +1,182 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+type matrix struct {
+	axes     map[string][]string
+	failFast bool
+}
+
+func parseMatrix(list *ast.ObjectList) (*matrix, error) {
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+
+	if len(list.Items) > 1 {
+		return nil, &ConfigError{
+			Issues: []string{"A task can only contain a single matrix block"},
+		}
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, list.Items[0].Val); err != nil {
+		return nil, err
+	}
+
+	result := &matrix{
+		axes:     make(map[string][]string),
+		failFast: true,
+	}
+
+	for k, v := range m {
+		if k == "fail_fast" {
+			failFast, ok := v.(bool)
+			if !ok {
+				return nil, &ConfigError{
+					Issues: []string{"Matrix fail_fast must be a boolean"},
+				}
+			}
+			result.failFast = failFast
+			continue
+		}
+
+		values, ok := v.([]interface{})
+		if !ok || len(values) == 0 {
+			return nil, &ConfigError{
+				Issues: []string{fmt.Sprintf("Matrix axis %s must be a list of one or more values", k)},
+			}
+		}
+
+		for _, val := range values {
+			result.axes[k] = append(result.axes[k], fmt.Sprintf("%v", val))
+		}
+	}
+
+	if len(result.axes) == 0 {
+		return nil, &ConfigError{
+			Issues: []string{"A matrix must define at least one axis"},
+		}
+	}
+
+	return result, nil
+}
+
+// combinations returns every combination of axis values within the matrix.
+func (m *matrix) combinations() []map[string]string {
+	names := []string{}
+	for name := range m.axes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := []map[string]string{{}}
+	for _, name := range names {
+		expanded := []map[string]string{}
+		for _, c := range result {
+			for _, v := range m.axes[name] {
+				combination := merge(c, map[string]string{name: v})
+				expanded = append(expanded, combination)
+			}
+		}
+		result = expanded
+	}
+
+	return result
+}
+
+func (m *matrix) expand(task *Task) []*Task {
+	variants := []*Task{}
+
+	for _, values := range m.combinations() {
+		variant := *task
+		variant.Name = MatrixTaskName(task.Name, values)
+		variant.BaseName = task.Name
+		variant.Matrix = values
+		variant.FailFast = m.failFast
+		variant.Steps = make(map[string]Step)
+		for k, v := range task.Steps {
+			variant.Steps[k] = v
+		}
+		variant.Finally = make(map[string]Step)
+		for k, v := range task.Finally {
+			variant.Finally[k] = v
+		}
+
+		variants = append(variants, &variant)
+	}
+
+	return variants
+}
+
+// MatrixTaskName builds the name of a matrix variant in the form name[axis=value,...].
+func MatrixTaskName(name string, values map[string]string) string {
+	pairs := []string{}
+	for k, v := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+
+	return fmt.Sprintf("%s[%s]", name, strings.Join(pairs, ","))
+}
+
+// ParseTaskSelector splits a task selector such as test[go=1.8] into the task
+// name and the matrix values it selects.
+func ParseTaskSelector(selector string) (string, map[string]string, error) {
+	values := make(map[string]string)
+
+	start := strings.Index(selector, "[")
+	if start == -1 {
+		return selector, values, nil
+	}
+
+	if !strings.HasSuffix(selector, "]") {
+		return "", nil, fmt.Errorf("Task selector %s is missing a closing ]", selector)
+	}
+
+	name := selector[:start]
+	for _, pair := range strings.Split(selector[start+1:len(selector)-1], ",") {
+		if len(pair) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return "", nil, fmt.Errorf("Task selector %s must be in the format name[axis=value,...]", selector)
+		}
+		values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return name, values, nil
+}
+
+func expandMatrixDependencies(tasks map[string]*Task) {
+	variants := make(map[string][]string)
+	for _, task := range tasks {
+		if len(task.BaseName) != 0 {
+			variants[task.BaseName] = append(variants[task.BaseName], task.Name)
+		}
+	}
+
+	for _, names := range variants {
+		sort.Strings(names)
+	}
+
+	for _, task := range tasks {
+		depends := []string{}
+		for _, d := range task.Depends {
+			if names, ok := variants[d]; ok {
+				depends = append(depends, names...)
+			} else {
+				depends = append(depends, d)
+			}
+		}
+		task.Depends = depends
+	}
+}
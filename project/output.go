@@ -0,0 +1,58 @@
+package project
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Outputs are the values written by steps to their CIMPLE_OUTPUT file, keyed
+// by task, step and then key.
+type Outputs map[string]map[string]map[string]string
+
+// Set records the outputs of a step.
+func (o Outputs) Set(task string, step string, values map[string]string) {
+	if _, ok := o[task]; !ok {
+		o[task] = make(map[string]map[string]string)
+	}
+	o[task][step] = values
+}
+
+// ReadOutputFile reads the key=value lines written by a step. Blank lines are
+// ignored and later values replace earlier values of the same key.
+func ReadOutputFile(path string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return values, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+
+		pair := strings.SplitN(text, "=", 2)
+		key := strings.TrimSpace(pair[0])
+		if len(pair) != 2 || len(key) == 0 {
+			return nil, fmt.Errorf("Output on line %d must be in the format key=value", line)
+		}
+
+		values[key] = pair[1]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
@@ -0,0 +1,34 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOutputFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "outputs")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "version")
+	ioutil.WriteFile(path, []byte("label=1.2.3\n\nurl=http://example.com/?a=b\r\nlabel=1.2.4\n"), 0644)
+
+	values, err := ReadOutputFile(path)
+	if assert.Nil(err) {
+		assert.Equal(map[string]string{"label": "1.2.4", "url": "http://example.com/?a=b"}, values)
+	}
+
+	ioutil.WriteFile(path, []byte("label\n"), 0644)
+	_, err = ReadOutputFile(path)
+	assert.EqualError(err, "Output on line 1 must be in the format key=value")
+
+	values, err = ReadOutputFile(filepath.Join(dir, "missing"))
+	if assert.Nil(err) {
+		assert.Empty(values)
+	}
+}
@@ -0,0 +1,332 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/lukesmith/cimple/logging"
+	"github.com/mitchellh/mapstructure"
+)
+
+// parallelStepParsers are the steps a parallel step may contain.
+var parallelStepParsers = []StepParser{&ScriptStepParser{}, &CommandStepParser{}, &ContainerStepParser{}}
+
+func isParallelStepToken(key string) bool {
+	for _, sp := range parallelStepParsers {
+		if sp.GetToken() == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ParallelStepParser struct {
+}
+
+func (p ParallelStepParser) GetToken() string {
+	return "parallel"
+}
+
+func (p ParallelStepParser) GetAttributes() []string {
+	attributes := []string{"cancel_on_failure", "env", "skip", "when", "always", "allow_failure"}
+	for _, sp := range parallelStepParsers {
+		attributes = append(attributes, sp.GetToken())
+	}
+	return attributes
+}
+
+func (p ParallelStepParser) Parse(item *ast.ObjectItem) (Step, error) {
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return nil, err
+	}
+
+	name := item.Keys[0].Token.Value().(string)
+
+	var s ParallelStep
+	s.name = name
+	s.env = make(map[string]string)
+
+	list := item.Val.(*ast.ObjectType).List
+	for _, token := range []string{"parallel", "publish"} {
+		if len(list.Filter(token).Items) != 0 {
+			return nil, &ConfigError{
+				Issues: []string{fmt.Sprintf("Parallel step %s can only contain command, script and container steps", name)},
+			}
+		}
+	}
+
+	steps := make(map[string]Step)
+	for _, sp := range parallelStepParsers {
+		for _, memberItem := range list.Filter(sp.GetToken()).Items {
+			step, err := sp.Parse(memberItem)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, exists := steps[step.GetName()]; exists {
+				return nil, &ConfigError{
+					Issues: []string{fmt.Sprintf("A step named %s exists multiple times in parallel step %s", step.GetName(), name)},
+				}
+			}
+			steps[step.GetName()] = step
+		}
+		delete(m, sp.GetToken())
+	}
+
+	if len(steps) == 0 {
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("Parallel step %s must contain at least one step", name)},
+		}
+	}
+
+	for _, item := range list.Items {
+		if len(item.Keys) > 1 && steps[item.Keys[1].Token.Value().(string)] != nil {
+			s.Steps = append(s.Steps, steps[item.Keys[1].Token.Value().(string)])
+		}
+	}
+
+	delete(m, "env")
+
+	if err := mapstructure.WeakDecode(m, &s); err != nil {
+		return nil, err
+	}
+
+	if err := parseEnvs(s.env, list.Filter("env")); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// checkParallelStepNames reports steps of parallel steps which share a name
+// with another step of the task.
+func checkParallelStepNames(steps map[string]Step) error {
+	seen := make(map[string]bool)
+	for _, step := range steps {
+		group, ok := step.(ParallelStep)
+		if !ok {
+			continue
+		}
+
+		for _, member := range group.Steps {
+			if _, exists := steps[member.GetName()]; exists || seen[member.GetName()] {
+				return &ConfigError{
+					Issues: []string{fmt.Sprintf("A step named %s exists multiple times", member.GetName())},
+				}
+			}
+			seen[member.GetName()] = true
+		}
+	}
+
+	return nil
+}
+
+// ParallelStep runs the steps it contains at the same time. It succeeds when
+// all of its steps succeed, or fail with AllowFailure, and with
+// CancelOnFailure the remaining steps, other than those which always run, are
+// cancelled when one fails.
+type ParallelStep struct {
+	name            string
+	Steps           []Step
+	CancelOnFailure bool `mapstructure:"cancel_on_failure"`
+	Skip            bool
+	When            string
+	Always          bool
+	AllowFailure    bool `mapstructure:"allow_failure"`
+	env             map[string]string
+}
+
+func (p ParallelStep) GetName() string {
+	return p.name
+}
+
+func (p ParallelStep) GetSkip() bool {
+	return p.Skip
+}
+
+func (p ParallelStep) GetWhen() string {
+	return p.When
+}
+
+func (p ParallelStep) GetEnv() map[string]string {
+	return p.env
+}
+
+func (p ParallelStep) GetRetry() Retry {
+	return Retry{}
+}
+
+func (p ParallelStep) GetAlways() bool {
+	return p.Always
+}
+
+func (p ParallelStep) GetAllowFailure() bool {
+	return p.AllowFailure
+}
+
+func (p ParallelStep) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) error {
+	cancel := make(chan struct{})
+	var once sync.Once
+	stop := func() {
+		once.Do(func() { close(cancel) })
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if vars.Cancel != nil {
+		go func() {
+			select {
+			case <-vars.Cancel:
+				stop()
+			case <-done:
+			}
+		}()
+	}
+
+	stdout = logging.NewSyncWriter(stdout)
+	stderr = logging.NewSyncWriter(stderr)
+
+	errs := make([]error, len(p.Steps))
+	outputs := make([]map[string]string, len(p.Steps))
+	var wg sync.WaitGroup
+	for i, step := range p.Steps {
+		wg.Add(1)
+		go func(i int, step Step) {
+			defer wg.Done()
+
+			// Steps which always run are only cancelled along with the build
+			stepCancel := (<-chan struct{})(cancel)
+			if step.GetAlways() {
+				stepCancel = vars.Cancel
+			}
+
+			stepVars := vars
+			if len(vars.OutputFile) != 0 {
+				stepVars.OutputFile = memberOutputFile(vars.OutputFile, step)
+				defer os.Remove(stepVars.OutputFile)
+			}
+
+			err := executeParallel(step, stepVars, stepCancel, stdout, stderr)
+			if err == nil && len(stepVars.OutputFile) != 0 {
+				outputs[i], err = ReadOutputFile(stepVars.OutputFile)
+			}
+			if err != nil && step.GetAllowFailure() {
+				fmt.Fprintf(stdout, "[%s] Failure allowed - %s\n", step.GetName(), err)
+				err = nil
+			}
+
+			errs[i] = err
+			if err != nil && p.CancelOnFailure {
+				stop()
+			}
+		}(i, step)
+	}
+	wg.Wait()
+
+	failures := []string{}
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s - %s", p.Steps[i].GetName(), err))
+		}
+	}
+
+	if len(failures) != 0 {
+		return fmt.Errorf("Parallel step %s failed: %s", p.name, strings.Join(failures, ", "))
+	}
+
+	if len(vars.OutputFile) != 0 {
+		return writeOutputFile(vars.OutputFile, outputs)
+	}
+
+	return nil
+}
+
+// memberOutputFile is the file a step of a parallel step writes its outputs
+// to, keeping them apart from those of the steps running alongside it.
+func memberOutputFile(outputFile string, step Step) string {
+	return outputFile + "." + step.GetName()
+}
+
+// writeOutputFile writes the outputs of the steps of a parallel step to the
+// output file of the parallel step, later steps replacing earlier values of
+// the same key.
+func writeOutputFile(path string, outputs []map[string]string) error {
+	var buf bytes.Buffer
+	for _, values := range outputs {
+		keys := []string{}
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "%s=%s\n", k, values[k])
+		}
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// executeParallel runs a step of a parallel step, retrying failed attempts as
+// specified by the step. Each line of output is prefixed with the step name.
+func executeParallel(step Step, vars StepVars, cancel <-chan struct{}, stdout io.Writer, stderr io.Writer) error {
+	if step.GetSkip() {
+		return nil
+	}
+
+	vars.StepEnv = merge(vars.StepEnv, step.GetEnv())
+	vars.Cancel = cancel
+
+	if when := step.GetWhen(); len(when) != 0 {
+		met, err := EvaluateCondition(when, vars)
+		if err != nil || !met {
+			return err
+		}
+	}
+
+	prefix := fmt.Sprintf("[%s] ", step.GetName())
+	out := logging.NewPrefixWriter(stdout, prefix)
+	errOut := logging.NewPrefixWriter(stderr, prefix)
+	defer func() {
+		out.Flush()
+		errOut.Flush()
+	}()
+
+	retry := step.GetRetry()
+	attempts := retry.GetAttempts()
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		// Only the outputs of the last attempt are kept.
+		if len(vars.OutputFile) != 0 {
+			if err := ioutil.WriteFile(vars.OutputFile, []byte{}, 0644); err != nil {
+				return err
+			}
+		}
+
+		err = step.Execute(vars, out, errOut)
+		if err == nil || err == ErrCancelled {
+			return err
+		}
+
+		if attempt < attempts {
+			backoff := retry.GetBackoff(attempt)
+			fmt.Fprintf(out, "Attempt %d of %d failed - %s. Retrying in %s\n", attempt, attempts, err, backoff)
+			if !sleepUntilCancelled(backoff, cancel) {
+				return ErrCancelled
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,208 @@
+package project
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lukesmith/cimple/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelStepParser(t *testing.T) {
+	assert := assert.New(t)
+
+	parallelHcl := `
+parallel checks {
+	cancel_on_failure = true
+
+	command vet {
+		command = "go"
+		args = ["vet", "./..."]
+	}
+
+	script lint {
+		body = "golint ./..."
+	}
+
+	command fmt {
+		command = "gofmt"
+	}
+
+	env {
+		CGO_ENABLED = "0"
+	}
+}
+`
+	item, err := extractStep(parallelHcl, "parallel")
+	if assert.Nil(err) {
+		step, err := (&ParallelStepParser{}).Parse(item)
+		if assert.Nil(err) {
+			parallel := step.(ParallelStep)
+			assert.Equal("checks", parallel.GetName())
+			assert.True(parallel.CancelOnFailure)
+			assert.Equal("0", parallel.GetEnv()["CGO_ENABLED"])
+
+			names := []string{}
+			for _, s := range parallel.Steps {
+				names = append(names, s.GetName())
+			}
+			assert.Equal([]string{"vet", "lint", "fmt"}, names)
+		}
+	}
+}
+
+func TestParallelStepParser_OnlyContainsCommandsScriptsAndContainers(t *testing.T) {
+	parallelHcl := `
+parallel checks {
+	publish binaries {
+		files = ["*.tar.gz"]
+	}
+}
+`
+	item, err := extractStep(parallelHcl, "parallel")
+	if assert.Nil(t, err) {
+		_, err := (&ParallelStepParser{}).Parse(item)
+		assert.Equal(t, &ConfigError{
+			Issues: []string{"Parallel step checks can only contain command, script and container steps"},
+		}, err)
+	}
+}
+
+func TestParallelStep_StepNamesUniqueWithinATask(t *testing.T) {
+	_, err := Load(`
+	name = "test"
+	version = "0.0.1"
+	task test {
+		command vet {
+			command = "go"
+		}
+
+		parallel checks {
+			command vet {
+				command = "go"
+			}
+		}
+	}
+	`)
+	assert.Equal(t, &ConfigError{
+		Issues: []string{"A step named vet exists multiple times"},
+	}, err)
+}
+
+func TestParallelStep_Execute(t *testing.T) {
+	assert := assert.New(t)
+
+	step := ParallelStep{
+		name: "checks",
+		Steps: []Step{
+			Command{name: "first", Command: "sh", Args: []string{"-c", "sleep 0.2; echo one"}, Env: map[string]string{}},
+			Command{name: "second", Command: "sh", Args: []string{"-c", "printf two"}, Env: map[string]string{}},
+		},
+	}
+
+	var out bytes.Buffer
+	start := time.Now()
+	err := step.Execute(StepVars{Cimple: &env.CimpleEnvironment{}}, &out, &out)
+	if assert.Nil(err) {
+		assert.Equal("[second] two\n[first] one\n", out.String())
+		assert.True(time.Since(start) < 2*time.Second)
+	}
+}
+
+func TestParallelStep_ExecuteFailure(t *testing.T) {
+	step := ParallelStep{
+		name: "checks",
+		Steps: []Step{
+			Command{name: "first", Command: "sh", Args: []string{"-c", "exit 1"}, Env: map[string]string{}},
+			Command{name: "second", Command: "sh", Args: []string{"-c", "sleep 0.2"}, Env: map[string]string{}},
+		},
+	}
+
+	var out bytes.Buffer
+	err := step.Execute(StepVars{Cimple: &env.CimpleEnvironment{}}, &out, &out)
+	assert.EqualError(t, err, "Parallel step checks failed: first - exit status 1")
+}
+
+func TestParallelStep_ExecuteCancelsOnFailure(t *testing.T) {
+	step := ParallelStep{
+		name:            "checks",
+		CancelOnFailure: true,
+		Steps: []Step{
+			Command{name: "first", Command: "sh", Args: []string{"-c", "exit 1"}, Env: map[string]string{}},
+			Command{name: "second", Command: "sleep", Args: []string{"5"}, Env: map[string]string{}},
+		},
+	}
+
+	var out bytes.Buffer
+	start := time.Now()
+	err := step.Execute(StepVars{Cimple: &env.CimpleEnvironment{}}, &out, &out)
+	assert.EqualError(t, err, "Parallel step checks failed: first - exit status 1, second - Cancelled")
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestParallelStep_ExecuteAllowsFailure(t *testing.T) {
+	step := ParallelStep{
+		name:            "checks",
+		CancelOnFailure: true,
+		Steps: []Step{
+			Command{name: "first", Command: "sh", Args: []string{"-c", "exit 1"}, AllowFailure: true, Env: map[string]string{}},
+			Command{name: "second", Command: "sh", Args: []string{"-c", "sleep 0.2; printf two"}, Env: map[string]string{}},
+		},
+	}
+
+	var out bytes.Buffer
+	err := step.Execute(StepVars{Cimple: &env.CimpleEnvironment{}}, &out, &out)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "[first] Failure allowed - exit status 1\n[second] two\n", out.String())
+	}
+}
+
+func TestParallelStep_ExecuteCancelsDuringBackoff(t *testing.T) {
+	step := ParallelStep{
+		name:            "checks",
+		CancelOnFailure: true,
+		Steps: []Step{
+			Command{name: "first", Command: "sh", Args: []string{"-c", "sleep 0.2; exit 1"}, Env: map[string]string{}},
+			Command{name: "second", Command: "sh", Args: []string{"-c", "exit 1"}, Retry: Retry{Attempts: 2, Backoff: "10s"}, Env: map[string]string{}},
+		},
+	}
+
+	var out bytes.Buffer
+	start := time.Now()
+	err := step.Execute(StepVars{Cimple: &env.CimpleEnvironment{}}, &out, &out)
+	assert.EqualError(t, err, "Parallel step checks failed: first - exit status 1, second - Cancelled")
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestParallelStep_ExecuteOutputs(t *testing.T) {
+	assert := assert.New(t)
+
+	f, _ := ioutil.TempFile("", "cimple-output")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	step := ParallelStep{
+		name: "checks",
+		Steps: []Step{
+			Command{name: "first", Command: "sh", Args: []string{"-c", "echo first=1 > $CIMPLE_OUTPUT; sleep 0.2"}, Env: map[string]string{}},
+			Command{name: "second", Command: "sh", Args: []string{"-c", "sleep 0.1; echo second=2 > $CIMPLE_OUTPUT"}, Env: map[string]string{}},
+		},
+	}
+
+	var out bytes.Buffer
+	err := step.Execute(StepVars{Cimple: &env.CimpleEnvironment{}, OutputFile: f.Name()}, &out, &out)
+	if assert.Nil(err) {
+		outputs, err := ReadOutputFile(f.Name())
+		if assert.Nil(err) {
+			assert.Equal(map[string]string{"first": "1", "second": "2"}, outputs)
+		}
+
+		for _, member := range step.Steps {
+			_, err := os.Stat(memberOutputFile(f.Name(), member))
+			assert.True(os.IsNotExist(err))
+		}
+	}
+}
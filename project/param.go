@@ -0,0 +1,192 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	ParamTypeString = "string"
+	ParamTypeBool   = "bool"
+	ParamTypeChoice = "choice"
+)
+
+// Param is a value supplied to a task when the build is run.
+type Param struct {
+	Name        string
+	Type        string
+	Description string
+	Choices     []string
+	// Default is used when no value is supplied. A param without a default
+	// must be supplied.
+	Default *string
+}
+
+func parseParams(list *ast.ObjectList) (map[string]*Param, error) {
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+
+	params := make(map[string]*Param)
+
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			return nil, &ConfigError{
+				Issues: []string{"A param must have a name"},
+			}
+		}
+
+		var m map[string]interface{}
+		if err := hcl.DecodeObject(&m, item.Val); err != nil {
+			return nil, err
+		}
+
+		param := &Param{
+			Name: item.Keys[0].Token.Value().(string),
+			Type: ParamTypeString,
+		}
+
+		if d, ok := m["default"]; ok {
+			value := fmt.Sprintf("%v", d)
+			param.Default = &value
+			delete(m, "default")
+		}
+
+		if err := mapstructure.WeakDecode(m, param); err != nil {
+			return nil, err
+		}
+
+		if _, exists := params[param.Name]; exists {
+			return nil, &ConfigError{
+				Issues: []string{fmt.Sprintf("A param named %s exists multiple times", param.Name)},
+			}
+		}
+
+		if err := param.validateDeclaration(); err != nil {
+			return nil, err
+		}
+
+		params[param.Name] = param
+	}
+
+	return params, nil
+}
+
+func (p *Param) validateDeclaration() error {
+	switch p.Type {
+	case ParamTypeString, ParamTypeBool:
+	case ParamTypeChoice:
+		if len(p.Choices) == 0 {
+			return &ConfigError{
+				Issues: []string{fmt.Sprintf("Param %s must specify the choices available", p.Name)},
+			}
+		}
+	default:
+		return &ConfigError{
+			Issues: []string{fmt.Sprintf("Param %s has unknown type %s. Available options %s, %s, %s", p.Name, p.Type, ParamTypeString, ParamTypeBool, ParamTypeChoice)},
+		}
+	}
+
+	if p.Default != nil {
+		if _, err := p.convert(*p.Default); err != nil {
+			return &ConfigError{
+				Issues: []string{fmt.Sprintf("The default of param %s is invalid - %s", p.Name, err)},
+			}
+		}
+	}
+
+	return nil
+}
+
+// convert checks the value is valid for the param, returning it in its
+// canonical form.
+func (p *Param) convert(value string) (string, error) {
+	switch p.Type {
+	case ParamTypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s is not a boolean", value)
+		}
+		return strconv.FormatBool(b), nil
+	case ParamTypeChoice:
+		for _, c := range p.Choices {
+			if c == value {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("%s is not one of %s", value, strings.Join(p.Choices, ", "))
+	}
+
+	return value, nil
+}
+
+// ResolveParams validates the supplied values against the params declared by
+// the task, applying defaults to those not supplied. When required is false
+// params without a value or default are left out rather than reported.
+func (t *Task) ResolveParams(values map[string]string, required bool) (map[string]string, []string) {
+	resolved := make(map[string]string)
+	issues := []string{}
+
+	name := t.Name
+	if len(t.BaseName) != 0 {
+		name = t.BaseName
+	}
+
+	for k, v := range values {
+		param, ok := t.Params[k]
+		if !ok {
+			issues = append(issues, fmt.Sprintf("Task %s does not declare a param named %s", name, k))
+			continue
+		}
+
+		converted, err := param.convert(v)
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("Param %s.%s is invalid - %s", name, k, err))
+			continue
+		}
+		resolved[k] = converted
+	}
+
+	for k, param := range t.Params {
+		if _, ok := values[k]; ok {
+			continue
+		}
+
+		if param.Default != nil {
+			resolved[k], _ = param.convert(*param.Default)
+		} else if required {
+			issues = append(issues, fmt.Sprintf("Param %s.%s must be supplied", name, k))
+		}
+	}
+
+	sort.Strings(issues)
+
+	return resolved, issues
+}
+
+// ParseParamArgs parses params in the form task.name=value, grouping the
+// values by task.
+func ParseParamArgs(args []string) (map[string]map[string]string, error) {
+	params := make(map[string]map[string]string)
+
+	for _, arg := range args {
+		pair := strings.SplitN(arg, "=", 2)
+		key := strings.SplitN(pair[0], ".", 2)
+		if len(pair) != 2 || len(key) != 2 || len(key[0]) == 0 || len(key[1]) == 0 {
+			return nil, fmt.Errorf("Param %s must be in the format task.name=value", arg)
+		}
+
+		if _, ok := params[key[0]]; !ok {
+			params[key[0]] = make(map[string]string)
+		}
+		params[key[0]][key[1]] = pair[1]
+	}
+
+	return params, nil
+}
@@ -0,0 +1,112 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseParams(t *testing.T) {
+	assert := assert.New(t)
+
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+	task deploy {
+		param environment {
+			type = "choice"
+			choices = ["staging", "production"]
+			default = "staging"
+			description = "The environment to deploy to"
+		}
+
+		param dry_run {
+			type = "bool"
+			default = false
+		}
+
+		param message {
+		}
+	}
+	`
+
+	cfg, err := Load(testconfig)
+	if !assert.Nil(err) {
+		return
+	}
+
+	params := cfg.Tasks["deploy"].Params
+	assert.Equal(ParamTypeChoice, params["environment"].Type)
+	assert.Equal([]string{"staging", "production"}, params["environment"].Choices)
+	assert.Equal("staging", *params["environment"].Default)
+	assert.Equal("The environment to deploy to", params["environment"].Description)
+	assert.Equal("false", *params["dry_run"].Default)
+	assert.Equal(ParamTypeString, params["message"].Type)
+	assert.Nil(params["message"].Default)
+}
+
+func TestParseParams_InvalidDeclarations(t *testing.T) {
+	configs := []string{
+		`param p { type = "number" }`,
+		`param p { type = "choice" }`,
+		`param p {
+			type = "bool"
+			default = "maybe"
+		}`,
+	}
+
+	for _, c := range configs {
+		_, err := Load(`
+		name = "test"
+		version = "0.0.1"
+		task deploy {
+		` + c + `
+		}`)
+		assert.IsType(t, &ConfigError{}, err, c)
+	}
+}
+
+func TestTask_ResolveParams(t *testing.T) {
+	assert := assert.New(t)
+
+	def := "staging"
+	task := &Task{
+		Name: "deploy",
+		Params: map[string]*Param{
+			"environment": {Name: "environment", Type: ParamTypeChoice, Choices: []string{"staging", "production"}, Default: &def},
+			"message":     {Name: "message", Type: ParamTypeString},
+		},
+	}
+
+	resolved, issues := task.ResolveParams(map[string]string{"message": "hi"}, true)
+	assert.Empty(issues)
+	assert.Equal(map[string]string{"environment": "staging", "message": "hi"}, resolved)
+
+	_, issues = task.ResolveParams(map[string]string{"environment": "qa", "other": "x"}, true)
+	assert.Equal([]string{
+		"Param deploy.environment is invalid - qa is not one of staging, production",
+		"Param deploy.message must be supplied",
+		"Task deploy does not declare a param named other",
+	}, issues)
+
+	resolved, issues = task.ResolveParams(map[string]string{}, false)
+	assert.Empty(issues)
+	assert.Equal(map[string]string{"environment": "staging"}, resolved)
+}
+
+func TestParseParamArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	params, err := ParseParamArgs([]string{"deploy.environment=production", "deploy.message=a=b", "test.go=1.8"})
+	if assert.Nil(err) {
+		assert.Equal(map[string]map[string]string{
+			"deploy": {"environment": "production", "message": "a=b"},
+			"test":   {"go": "1.8"},
+		}, params)
+	}
+
+	for _, arg := range []string{"deploy", "deploy=x", "deploy.=x", ".x=y"} {
+		_, err := ParseParamArgs([]string{arg})
+		assert.NotNil(err, arg)
+	}
+}
@@ -0,0 +1,111 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	exec "os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrCancelled is returned by a step which was stopped by closing the Cancel
+// channel of its StepVars.
+var ErrCancelled = errors.New("Cancelled")
+
+// processes are the running commands whose process groups are killed by
+// KillProcesses. Once killed any further command is killed as it starts.
+var processes = struct {
+	sync.Mutex
+	cmds   map[*exec.Cmd]bool
+	killed bool
+}{cmds: make(map[*exec.Cmd]bool)}
+
+func trackProcess(cmd *exec.Cmd) {
+	processes.Lock()
+	defer processes.Unlock()
+
+	if processes.killed {
+		killProcessGroup(cmd)
+	}
+	processes.cmds[cmd] = true
+}
+
+func untrackProcess(cmd *exec.Cmd) {
+	processes.Lock()
+	defer processes.Unlock()
+
+	delete(processes.cmds, cmd)
+}
+
+// KillProcesses kills the process groups of the running steps and services,
+// along with those started afterwards, so they do not outlive an interrupted
+// build.
+func KillProcesses() {
+	processes.Lock()
+	defer processes.Unlock()
+
+	processes.killed = true
+	for cmd := range processes.cmds {
+		killProcessGroup(cmd)
+	}
+}
+
+// runProcess runs the command, killing it along with any processes it has
+// started if it does not complete within the timeout or cancel is closed.
+func runProcess(cmd *exec.Cmd, timeout time.Duration, cancel <-chan struct{}) error {
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	trackProcess(cmd)
+	defer untrackProcess(cmd)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timedOut <-chan time.Time
+	if timeout > 0 {
+		timedOut = time.After(timeout)
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-timedOut:
+		killProcessGroup(cmd)
+		<-done
+		return fmt.Errorf("Timed out after %s", timeout)
+	case <-cancel:
+		killProcessGroup(cmd)
+		<-done
+		return ErrCancelled
+	}
+}
+
+// stepWorkingDir determines the directory a step runs within. Relative
+// directories are within the working directory of the build.
+func stepWorkingDir(name string, dir string, vars StepVars) (string, error) {
+	if len(dir) == 0 {
+		return vars.WorkingDir, nil
+	}
+
+	dir, err := renderTemplate(name+".working_dir", dir, vars)
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(vars.WorkingDir, dir)
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("Working directory %s of step %s does not exist", dir, name)
+	}
+
+	return dir, nil
+}
@@ -0,0 +1,28 @@
+package project
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKillProcesses_KillsRunningSteps(t *testing.T) {
+	defer func() { processes.killed = false }()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runProcess(exec.Command("sleep", "30"), 0, nil)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	KillProcesses()
+
+	select {
+	case err := <-done:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the step to be killed")
+	}
+}
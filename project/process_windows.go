@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package project
+
+import (
+	"fmt"
+	exec "os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	// taskkill /T terminates the process tree
+	exec.Command("taskkill", "/F", "/T", "/PID", fmt.Sprintf("%d", cmd.Process.Pid)).Run()
+}
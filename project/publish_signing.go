@@ -0,0 +1,133 @@
+package project
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	checksumsFile      = "SHA256SUMS"
+	signatureExtension = ".sig"
+)
+
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// pkcs8 is the PKCS #8 encoding of a private key.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// writeChecksums writes a manifest of the sha256 of each file, in the format
+// of sha256sum, to path. The manifest is only written when write is set.
+func writeChecksums(files []string, path string, write bool) (string, error) {
+	if !write {
+		return path, nil
+	}
+
+	var manifest bytes.Buffer
+	for _, f := range files {
+		sum, err := sha256File(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&manifest, "%s  %s\n", sum, filepath.Base(f))
+	}
+
+	return path, ioutil.WriteFile(path, manifest.Bytes(), 0644)
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// signatureFiles returns the path within dir of the signature of each file.
+func signatureFiles(files []string, dir string) []string {
+	signatures := []string{}
+	for _, f := range files {
+		signatures = append(signatures, filepath.Join(dir, filepath.Base(f)+signatureExtension))
+	}
+	return signatures
+}
+
+// signFiles writes a detached signature of each file into dir, containing the
+// base64 encoded ed25519 signature of the file.
+func signFiles(files []string, dir string, key ed25519.PrivateKey) ([]string, error) {
+	signatures := signatureFiles(files, dir)
+	for i, f := range files {
+		d, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, d))
+		if err := ioutil.WriteFile(signatures[i], []byte(signature+"\n"), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	return signatures, nil
+}
+
+// ParseSigningKey parses an ed25519 private key, either PEM encoded PKCS #8 or
+// the base64 encoded seed or private key.
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	s = strings.TrimSpace(s)
+
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		var key pkcs8
+		if _, err := asn1.Unmarshal(block.Bytes, &key); err != nil {
+			return nil, fmt.Errorf("The key is not a PKCS #8 key - %s", err)
+		}
+
+		if !key.Algo.Algorithm.Equal(oidEd25519) {
+			return nil, errors.New("The key is not an ed25519 key")
+		}
+
+		var seed []byte
+		if _, err := asn1.Unmarshal(key.PrivateKey, &seed); err != nil || len(seed) != ed25519.SeedSize {
+			return nil, errors.New("The key is not a valid ed25519 key")
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+
+	d, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("The key must be PEM encoded or base64 encoded")
+	}
+
+	switch len(d) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(d), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(d), nil
+	}
+
+	return nil, fmt.Errorf("The key must be %d or %d bytes - was %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(d))
+}
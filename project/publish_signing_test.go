@@ -0,0 +1,37 @@
+package project
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestParseSigningKey(t *testing.T) {
+	assert := assert.New(t)
+
+	_, key, _ := ed25519.GenerateKey(nil)
+	seed, _ := asn1.Marshal(key.Seed())
+	der, _ := asn1.Marshal(pkcs8{Algo: pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, PrivateKey: seed})
+
+	for _, encoded := range []string{
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		base64.StdEncoding.EncodeToString(key.Seed()),
+		base64.StdEncoding.EncodeToString(key) + "\n",
+	} {
+		parsed, err := ParseSigningKey(encoded)
+		if assert.Nil(err) {
+			assert.Equal(key, parsed)
+		}
+	}
+
+	_, err := ParseSigningKey("not a key")
+	assert.EqualError(err, "The key must be PEM encoded or base64 encoded")
+
+	_, err = ParseSigningKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.EqualError(err, "The key must be 32 or 64 bytes - was 5")
+}
@@ -1,24 +1,27 @@
 package project
 
 import (
-	"bytes"
 	"fmt"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
 	"github.com/mitchellh/mapstructure"
 	"io"
 	"io/ioutil"
-	"log"
-	"net/http"
 	"os"
 	"path/filepath"
-	"text/template"
 )
 
-type publishDestination interface {
+// PublishDestination uploads the files matched by a publish step.
+type PublishDestination interface {
 	Execute(files []string, vars StepVars, stdout io.Writer, stderr io.Writer) error
 }
 
+// TargetedDestination is implemented by destinations which can describe
+// where each file would be published, as listed by a dry run.
+type TargetedDestination interface {
+	Targets(files []string, vars StepVars) ([]string, error)
+}
+
 type PublishParser struct {
 }
 
@@ -26,6 +29,10 @@ func (p PublishParser) GetToken() string {
 	return "publish"
 }
 
+func (p PublishParser) GetAttributes() []string {
+	return []string{"files", "destination", "signing_key", "env", "skip", "when", "always", "allow_failure", "retry"}
+}
+
 func (p PublishParser) Parse(item *ast.ObjectItem) (Step, error) {
 	var m map[string]interface{}
 	if err := hcl.DecodeObject(&m, item.Val); err != nil {
@@ -37,7 +44,7 @@ func (p PublishParser) Parse(item *ast.ObjectItem) (Step, error) {
 	var c PublishStep
 	c.name = name
 	c.env = make(map[string]string)
-	c.Destinations = make([]publishDestination, 0)
+	c.Destinations = make([]PublishDestination, 0)
 
 	a := item.Val.(*ast.ObjectType).List
 	destinations := a.Filter("destination")
@@ -50,9 +57,9 @@ func (p PublishParser) Parse(item *ast.ObjectItem) (Step, error) {
 	}
 
 	delete(m, "env")
+	delete(m, "retry")
 
 	if err := mapstructure.WeakDecode(m, &c); err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 
@@ -60,30 +67,26 @@ func (p PublishParser) Parse(item *ast.ObjectItem) (Step, error) {
 		return nil, err
 	}
 
-	return c, nil
-}
-
-func parseDestination(item *ast.ObjectItem) (publishDestination, error) {
-	var m map[string]interface{}
-	if err := hcl.DecodeObject(&m, item.Val); err != nil {
-		log.Fatal(err)
-		return nil, err
-	}
-	destination := &bintrayPublishDestination{}
-
-	if err := mapstructure.WeakDecode(m, &destination); err != nil {
-		log.Fatal(err)
+	retry, err := parseRetry(a.Filter("retry"))
+	if err != nil {
 		return nil, err
 	}
+	c.Retry = retry
 
-	return destination, nil
+	return c, nil
 }
 
 type PublishStep struct {
-	name         string
-	Files        []string
+	name  string
+	Files []string
+	// SigningKey is the key of the signing secret used to sign each file.
+	SigningKey   string `mapstructure:"signing_key"`
 	Skip         bool
-	Destinations []publishDestination
+	When         string
+	Retry        Retry
+	Always       bool
+	AllowFailure bool `mapstructure:"allow_failure"`
+	Destinations []PublishDestination
 	env          map[string]string
 }
 
@@ -95,105 +98,149 @@ func (c PublishStep) GetSkip() bool {
 	return c.Skip
 }
 
+func (c PublishStep) GetWhen() string {
+	return c.When
+}
+
 func (c PublishStep) GetEnv() map[string]string {
 	return c.env
 }
 
-func (c PublishStep) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) error {
-	for _, destination := range c.Destinations {
-		files := []string{}
-		for _, f := range c.Files {
-			path, err := templateString(f, vars)
-			if err != nil {
-				return err
-			}
-			matches, err := filepath.Glob(path)
-			if err != nil {
-				return err
-			}
-			files = append(files, matches...)
-		}
-		err := destination.Execute(files, vars, stdout, stderr)
-		if err != nil {
-			return err
-		}
-	}
+func (c PublishStep) GetRetry() Retry {
+	return c.Retry
+}
 
-	return nil
+func (c PublishStep) GetAlways() bool {
+	return c.Always
+}
+
+func (c PublishStep) GetAllowFailure() bool {
+	return c.AllowFailure
 }
 
-func templateString(s string, vars StepVars) (string, error) {
-	tmpl, err := template.New("t").Parse(s)
+// Execute publishes the matched files, along with a SHA256SUMS manifest and
+// their signatures, to each destination. A dry run lists where the files
+// would be published instead.
+func (c PublishStep) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) error {
+	files, err := c.matchFiles(vars)
 	if err != nil {
-		return "", err
+		return err
 	}
-	var doc bytes.Buffer
-	tmpl.Execute(&doc, vars)
-	res := doc.String()
 
-	return res, nil
-}
-
-type bintrayPublishDestination struct {
-	Subject    string
-	Repository string
-	Package    string
-	Username   string
-}
+	dir, err := ioutil.TempDir("", "publish")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
 
-func (b bintrayPublishDestination) Execute(files []string, vars StepVars, stdout io.Writer, stderr io.Writer) error {
-	subject := b.Subject
-	repository := b.Repository
-	version := vars.Project.Version
-	pkg := b.Package
-	username := b.Username
-	password, err := vars.Secrets.Get("bintray", b.Username)
+	manifest, err := writeChecksums(files, filepath.Join(dir, checksumsFile), !vars.DryRunPublish)
 	if err != nil {
 		return err
 	}
+	files = append(files, manifest)
 
-	for _, f := range files {
-		filePath, err := filepath.Abs(f)
+	if len(c.SigningKey) != 0 {
+		signatures, err := c.sign(files, dir, vars)
 		if err != nil {
 			return err
 		}
-		fileName := filepath.Base(filePath)
-		url := fmt.Sprintf("https://api.bintray.com/content/%s/%s/%s/%s/%s", subject, repository, pkg, version, fileName)
-		file, err := os.Open(filePath)
-		if err != nil {
+		files = append(files, signatures...)
+	}
+
+	for i, destination := range c.Destinations {
+		if vars.DryRunPublish {
+			if err := describeDestination(destination, i, files, vars, stdout); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := destination.Execute(files, vars, stdout, stderr); err != nil {
 			return err
 		}
-		defer file.Close()
+	}
 
-		fi, err := file.Stat()
+	return nil
+}
+
+// matchFiles returns the files matching each pattern, failing when a pattern
+// matches nothing.
+func (c PublishStep) matchFiles(vars StepVars) ([]string, error) {
+	files := []string{}
+	for i, f := range c.Files {
+		path, err := renderTemplate(fmt.Sprintf("%s.files[%d]", c.name, i), f, vars)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		req, err := http.NewRequest("PUT", url, file)
+		matches, err := filepath.Glob(path)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		req.ContentLength = int64(fi.Size())
-		req.SetBasicAuth(username, password)
 
-		client := &http.Client{}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No files match %s in publish step %s", path, c.name)
+		}
 
-		log.Printf("Publishing %s to %s", filePath, url)
+		files = append(files, matches...)
+	}
 
-		res, err := client.Do(req)
-		if err != nil {
-			return err
+	return files, checkPublishedNames(files)
+}
+
+// checkPublishedNames fails when two files would be published under the same
+// name, as only their base name is kept in the manifest and at destinations.
+func checkPublishedNames(files []string) error {
+	names := map[string]string{checksumsFile: checksumsFile}
+	for _, f := range files {
+		name := filepath.Base(f)
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("Files %s and %s would both be published as %s", other, f, name)
 		}
+		names[name] = f
+	}
 
-		defer res.Body.Close()
-		body, err := ioutil.ReadAll(res.Body)
+	return nil
+}
+
+func (c PublishStep) sign(files []string, dir string, vars StepVars) ([]string, error) {
+	if vars.DryRunPublish {
+		return signatureFiles(files, dir), nil
+	}
+
+	if vars.Secrets == nil {
+		return nil, fmt.Errorf("No secrets are available to retrieve the signing key %s", c.SigningKey)
+	}
+
+	secret, err := vars.Secrets.Get("signing", c.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParseSigningKey(secret)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signing key %s - %s", c.SigningKey, err)
+	}
 
-		if res.StatusCode != 201 {
-			return fmt.Errorf("Failed to publish %s. Receieved %d response - %s", filePath, res.StatusCode, body)
-		} else {
-			log.Printf("Published %s", filePath)
+	return signFiles(files, dir, key)
+}
+
+func describeDestination(destination PublishDestination, index int, files []string, vars StepVars, stdout io.Writer) error {
+	targeted, ok := destination.(TargetedDestination)
+	if !ok {
+		for _, f := range files {
+			fmt.Fprintf(stdout, "Would publish %s to destination %d\n", filepath.Base(f), index+1)
 		}
+		return nil
+	}
+
+	targets, err := targeted.Targets(files, vars)
+	if err != nil {
+		return err
+	}
+
+	for i, f := range files {
+		fmt.Fprintf(stdout, "Would publish %s to %s\n", filepath.Base(f), targets[i])
 	}
 
 	return nil
@@ -1,10 +1,18 @@
 package project
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -46,6 +54,7 @@ publish example {
 		subject = "my-subject"
 		repository = "my-repo"
 		package = "my-package"
+		username = "my-user"
 	}
 	files = ["/path/to/files"]
 }
@@ -64,6 +73,7 @@ publish example {
 		assert.Equal("my-subject", destination.Subject)
 		assert.Equal("my-repo", destination.Repository)
 		assert.Equal("my-package", destination.Package)
+		assert.Equal("my-user", destination.Username)
 	}
 }
 
@@ -76,11 +86,13 @@ publish example {
 		subject = "my-subject"
 		repository = "my-repo"
 		package = "my-package"
+		username = "my-user"
 	}
 	destination bintray {
 		subject = "my-other-subject"
 		repository = "my-other-repo"
 		package = "my-other-package"
+		username = "my-user"
 	}
 	files = ["/path/to/files"]
 }
@@ -96,7 +108,101 @@ publish example {
 	}
 }
 
+func TestPublishParser_UnknownDestination(t *testing.T) {
+	publishHcl := `
+publish example {
+	destination ftp {
+		host = "example.com"
+	}
+	files = ["/path/to/files"]
+}
+`
+	ast, err := extractObject(publishHcl)
+	if assert.Nil(t, err) {
+		_, err := (&PublishParser{}).Parse(ast)
+		assert.Equal(t, &ConfigError{
+			Issues: []string{"Unknown destination type ftp. Available options bintray, directory, http, s3"},
+		}, err)
+	}
+}
+
+func TestPublishParser_ValidatesDestination(t *testing.T) {
+	publishHcl := `
+publish example {
+	destination bintray {
+		subject = "my-subject"
+		repo = "my-repo"
+	}
+	files = ["/path/to/files"]
+}
+`
+	ast, err := extractObject(publishHcl)
+	if assert.Nil(t, err) {
+		_, err := (&PublishParser{}).Parse(ast)
+		assert.Equal(t, &ConfigError{
+			Issues: []string{"Unknown attribute repo in bintray destination"},
+		}, err)
+	}
+}
+
+func TestPublishParser_RegisteredDestination(t *testing.T) {
+	assert := assert.New(t)
+
+	RegisterDestination("fake", func(item *ast.ObjectItem) (PublishDestination, error) {
+		d := &fakeDestination{}
+		return d, DecodeDestination(item, d)
+	})
+	defer delete(destinationParsers, "fake")
+
+	publishHcl := `
+publish example {
+	destination fake {
+		target = "somewhere"
+	}
+	files = ["/path/to/files"]
+}
+`
+	ast, err := extractObject(publishHcl)
+	if assert.Nil(err) {
+		step, err := (&PublishParser{}).Parse(ast)
+		if assert.Nil(err) {
+			assert.Equal("somewhere", step.(PublishStep).Destinations[0].(*fakeDestination).Target)
+		}
+	}
+}
+
+func TestDirectoryDestination_Execute(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "cimple.tar.gz")
+	ioutil.WriteFile(src, []byte("hello"), 0644)
+
+	destination := directoryPublishDestination{Path: filepath.Join(dir, "dist", "{{.Project.Version}}")}
+	var out bytes.Buffer
+	err := destination.Execute([]string{src}, StepVars{Project: Project{Version: "1.0.0"}}, &out, &out)
+	if assert.Nil(err) {
+		d, err := ioutil.ReadFile(filepath.Join(dir, "dist", "1.0.0", "cimple.tar.gz"))
+		if assert.Nil(err) {
+			assert.Equal("hello", string(d))
+		}
+	}
+}
+
+type fakeDestination struct {
+	Target string
+}
+
+func (f *fakeDestination) Execute(files []string, vars StepVars, stdout io.Writer, stderr io.Writer) error {
+	return nil
+}
+
 func extractObject(h string) (*ast.ObjectItem, error) {
+	return extractStep(h, "publish")
+}
+
+func extractStep(h string, token string) (*ast.ObjectItem, error) {
 	file, err := hcl.Parse(h)
 	if err != nil {
 		return nil, err
@@ -107,7 +213,117 @@ func extractObject(h string) (*ast.ObjectItem, error) {
 		return nil, fmt.Errorf("Failed to turn node into ObjectList")
 	}
 
-	matches := list.Filter("publish")
+	matches := list.Filter(token)
 
 	return matches.Items[0], nil
 }
+
+func TestPublishStep_Execute(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "cimple.tar.gz"), []byte("hello"), 0644)
+
+	_, key, _ := ed25519.GenerateKey(nil)
+	step := PublishStep{
+		name:         "binaries",
+		Files:        []string{filepath.Join(dir, "*.tar.gz")},
+		SigningKey:   "release",
+		Destinations: []PublishDestination{&directoryPublishDestination{Path: filepath.Join(dir, "dist")}},
+	}
+	vars := StepVars{Secrets: &fakeSecretStore{secrets: map[string]string{
+		"signing:release": base64.StdEncoding.EncodeToString(key.Seed()),
+	}}}
+
+	var out bytes.Buffer
+	err := step.Execute(vars, &out, &out)
+	if !assert.Nil(err) {
+		return
+	}
+
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, "dist", "SHA256SUMS"))
+	if assert.Nil(err) {
+		assert.Equal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  cimple.tar.gz\n", string(manifest))
+	}
+
+	for _, f := range []string{"cimple.tar.gz", "SHA256SUMS"} {
+		d, _ := ioutil.ReadFile(filepath.Join(dir, "dist", f))
+		signature, err := ioutil.ReadFile(filepath.Join(dir, "dist", f+".sig"))
+		if assert.Nil(err) {
+			s, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+			assert.True(ed25519.Verify(key.Public().(ed25519.PublicKey), d, s), f)
+		}
+	}
+}
+
+func TestPublishStep_ExecuteDryRun(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "cimple.tar.gz"), []byte("hello"), 0644)
+
+	step := PublishStep{
+		name:       "binaries",
+		Files:      []string{filepath.Join(dir, "*.tar.gz")},
+		SigningKey: "release",
+		Destinations: []PublishDestination{
+			&directoryPublishDestination{Path: filepath.Join(dir, "dist")},
+			&fakeDestination{},
+		},
+	}
+
+	var out bytes.Buffer
+	err := step.Execute(StepVars{DryRunPublish: true}, &out, &out)
+	if assert.Nil(err) {
+		dist := filepath.Join(dir, "dist")
+		assert.Equal(strings.Join([]string{
+			"Would publish cimple.tar.gz to " + filepath.Join(dist, "cimple.tar.gz"),
+			"Would publish SHA256SUMS to " + filepath.Join(dist, "SHA256SUMS"),
+			"Would publish cimple.tar.gz.sig to " + filepath.Join(dist, "cimple.tar.gz.sig"),
+			"Would publish SHA256SUMS.sig to " + filepath.Join(dist, "SHA256SUMS.sig"),
+			"Would publish cimple.tar.gz to destination 2",
+			"Would publish SHA256SUMS to destination 2",
+			"Would publish cimple.tar.gz.sig to destination 2",
+			"Would publish SHA256SUMS.sig to destination 2",
+		}, "\n")+"\n", out.String())
+
+		_, err := os.Stat(dist)
+		assert.True(os.IsNotExist(err))
+	}
+}
+
+func TestPublishStep_ExecuteNoMatches(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+
+	step := PublishStep{
+		name:         "binaries",
+		Files:        []string{filepath.Join(dir, "*.tar.gz")},
+		Destinations: []PublishDestination{&directoryPublishDestination{Path: filepath.Join(dir, "dist")}},
+	}
+
+	var out bytes.Buffer
+	err := step.Execute(StepVars{}, &out, &out)
+	assert.EqualError(t, err, "No files match "+filepath.Join(dir, "*.tar.gz")+" in publish step binaries")
+}
+
+func TestPublishStep_ExecuteSameNameFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "publish")
+	defer os.RemoveAll(dir)
+	for _, d := range []string{"linux", "darwin"} {
+		os.MkdirAll(filepath.Join(dir, d), 0755)
+		ioutil.WriteFile(filepath.Join(dir, d, "cimple.tar.gz"), []byte(d), 0644)
+	}
+
+	step := PublishStep{
+		name:         "binaries",
+		Files:        []string{filepath.Join(dir, "linux", "*.tar.gz"), filepath.Join(dir, "darwin", "*.tar.gz")},
+		Destinations: []PublishDestination{&directoryPublishDestination{Path: filepath.Join(dir, "dist")}},
+	}
+
+	var out bytes.Buffer
+	err := step.Execute(StepVars{}, &out, &out)
+	assert.EqualError(t, err, "Files "+filepath.Join(dir, "linux", "cimple.tar.gz")+" and "+filepath.Join(dir, "darwin", "cimple.tar.gz")+" would both be published as cimple.tar.gz")
+}
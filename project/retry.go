@@ -0,0 +1,107 @@
+package project
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/mitchellh/mapstructure"
+)
+
+var sleep = time.Sleep
+
+// sleepUntilCancelled waits for d, returning false when cancel is closed
+// before it has elapsed.
+func sleepUntilCancelled(d time.Duration, cancel <-chan struct{}) bool {
+	slept := make(chan struct{})
+	go func() {
+		sleep(d)
+		close(slept)
+	}()
+
+	select {
+	case <-slept:
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
+// Retry specifies how many times a step is attempted and how long to wait
+// between attempts. The backoff doubles after each failed attempt.
+type Retry struct {
+	Attempts int
+	Backoff  string
+}
+
+func (r Retry) GetAttempts() int {
+	if r.Attempts < 1 {
+		return 1
+	}
+
+	return r.Attempts
+}
+
+func (r Retry) GetBackoff(attempt int) time.Duration {
+	backoff, err := time.ParseDuration(r.Backoff)
+	if err != nil || attempt < 1 {
+		return 0
+	}
+
+	return backoff * time.Duration(1<<uint(attempt-1))
+}
+
+func parseRetry(list *ast.ObjectList) (Retry, error) {
+	var retry Retry
+
+	if len(list.Items) == 0 {
+		return retry, nil
+	}
+
+	if len(list.Items) > 1 {
+		return retry, &ConfigError{
+			Issues: []string{"A step can only contain a single retry block"},
+		}
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, list.Items[0].Val); err != nil {
+		return retry, err
+	}
+
+	if err := mapstructure.WeakDecode(m, &retry); err != nil {
+		return retry, err
+	}
+
+	if retry.Attempts < 1 {
+		return retry, &ConfigError{
+			Issues: []string{fmt.Sprintf("Retry attempts must be at least 1 - was %d", retry.Attempts)},
+		}
+	}
+
+	if len(retry.Backoff) != 0 {
+		if _, err := time.ParseDuration(retry.Backoff); err != nil {
+			return retry, &ConfigError{
+				Issues: []string{fmt.Sprintf("Retry backoff %s is not a valid duration", retry.Backoff)},
+			}
+		}
+	}
+
+	return retry, nil
+}
+
+func parseTimeout(timeout string) (time.Duration, error) {
+	if len(timeout) == 0 {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, &ConfigError{
+			Issues: []string{fmt.Sprintf("Timeout %s is not a valid duration", timeout)},
+		}
+	}
+
+	return d, nil
+}
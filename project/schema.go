@@ -0,0 +1,220 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/printer"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+// SchemaVersion is the newest version of the configuration schema which can be
+// loaded.
+const SchemaVersion = "0.0.5"
+
+// migration upgrades a configuration to a newer version of the schema.
+type migration struct {
+	version     string
+	description string
+	apply       func(list *ast.ObjectList) error
+}
+
+// migrations are applied in order to configurations declaring an older schema
+// version. Versions without a migration did not rename or restructure anything.
+var migrations = []migration{
+	{
+		version:     "0.0.5",
+		description: "Labelled publish destinations with their type, bintray",
+		apply:       labelBintrayDestinations,
+	},
+}
+
+// labelBintrayDestinations labels every publish destination as bintray. Prior
+// to 0.0.5 the label was ignored and every destination published to bintray.
+func labelBintrayDestinations(list *ast.ObjectList) error {
+	for _, task := range itemsWithKey(list, "task") {
+		for _, step := range itemsWithKey(task, "publish") {
+			for _, destination := range itemsWithKey(step, "destination") {
+				label := &ast.ObjectKey{Token: token.Token{Type: token.IDENT, Text: "bintray"}}
+				if len(destination.Keys) == 1 {
+					destination.Keys = append(destination.Keys, label)
+				} else {
+					destination.Keys[1] = label
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// itemsWithKey returns the items within the block of item, or within list
+// when item is an ObjectList, whose first key is key. Unlike Filter the items
+// are returned unchanged so they can be modified in place.
+func itemsWithKey(node ast.Node, key string) []*ast.ObjectItem {
+	var list *ast.ObjectList
+	switch n := node.(type) {
+	case *ast.ObjectList:
+		list = n
+	case *ast.ObjectItem:
+		ot, ok := n.Val.(*ast.ObjectType)
+		if !ok {
+			return nil
+		}
+		list = ot.List
+	}
+
+	items := []*ast.ObjectItem{}
+	for _, item := range list.Items {
+		if len(item.Keys) != 0 && item.Keys[0].Token.Value() == key {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseSchemaVersion(version string) ([]int, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Schema version %s must be in the format major.minor.patch", version)
+	}
+
+	result := []int{}
+	for _, p := range parts {
+		i, err := strconv.Atoi(p)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("Schema version %s must be in the format major.minor.patch", version)
+		}
+		result = append(result, i)
+	}
+
+	return result, nil
+}
+
+func compareSchemaVersions(a []int, b []int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// schemaVersionToken finds the token holding the version within the cimple
+// block. nil is returned when no version has been declared.
+func schemaVersionToken(list *ast.ObjectList) (*token.Token, error) {
+	blocks := list.Filter("cimple").Items
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+
+	if len(blocks) > 1 {
+		return nil, &ConfigError{
+			Issues: []string{"Only a single cimple block can be specified"},
+		}
+	}
+
+	ot, ok := blocks[0].Val.(*ast.ObjectType)
+	if !ok {
+		return nil, &ConfigError{
+			Issues: []string{"cimple must be a block"},
+		}
+	}
+
+	versions := ot.List.Filter("version").Items
+	if len(versions) == 0 {
+		return nil, nil
+	}
+
+	lit, ok := versions[0].Val.(*ast.LiteralType)
+	if !ok || lit.Token.Type != token.STRING {
+		return nil, &ConfigError{
+			Issues: []string{"The cimple version must be a string"},
+		}
+	}
+
+	return &lit.Token, nil
+}
+
+// migrateSchema upgrades the configuration to the current schema version,
+// returning a description of each change made. Configurations without a
+// declared version are treated as using the current schema.
+func migrateSchema(list *ast.ObjectList) ([]string, error) {
+	tok, err := schemaVersionToken(list)
+	if err != nil || tok == nil {
+		return []string{}, err
+	}
+
+	declared := tok.Value().(string)
+	version, err := parseSchemaVersion(declared)
+	if err != nil {
+		return nil, &ConfigError{Issues: []string{err.Error()}}
+	}
+
+	current, _ := parseSchemaVersion(SchemaVersion)
+	switch compareSchemaVersions(version, current) {
+	case 0:
+		return []string{}, nil
+	case 1:
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("Schema version %s is newer than the supported version %s. Upgrade Cimple to load this configuration", declared, SchemaVersion)},
+		}
+	}
+
+	changes := []string{}
+	for _, m := range migrations {
+		target, _ := parseSchemaVersion(m.version)
+		if compareSchemaVersions(version, target) >= 0 {
+			continue
+		}
+
+		if err := m.apply(list); err != nil {
+			return nil, err
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s", m.version, m.description))
+	}
+
+	tok.Text = strconv.Quote(SchemaVersion)
+	changes = append(changes, fmt.Sprintf("Updated schema version from %s to %s", declared, SchemaVersion))
+
+	return changes, nil
+}
+
+// Migrate rewrites a configuration to the current schema version, returning
+// the rewritten configuration and a description of each change made.
+func Migrate(str string) ([]byte, []string, error) {
+	obj, err := hcl.Parse(str)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, nil, fmt.Errorf("Node is not an ObjectList")
+	}
+
+	changes, err := migrateSchema(list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(changes) == 0 {
+		return []byte(str), changes, nil
+	}
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, obj); err != nil {
+		return nil, nil, err
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), changes, nil
+}
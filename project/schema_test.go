@@ -0,0 +1,271 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_RejectsNewerSchemaVersion(t *testing.T) {
+	const testconfig = `
+	cimple {
+		version = "99.0.0"
+	}
+	name = "test"
+	version = "0.0.1"
+	`
+
+	_, err := Load(testconfig)
+	if assert.IsType(t, &ConfigError{}, err) {
+		assert.Contains(t, err.Error(), "Schema version 99.0.0 is newer than the supported version")
+	}
+}
+
+func TestLoad_RejectsInvalidSchemaVersion(t *testing.T) {
+	const testconfig = `
+	cimple {
+		version = "latest"
+	}
+	name = "test"
+	version = "0.0.1"
+	`
+
+	_, err := Load(testconfig)
+	assert.IsType(t, &ConfigError{}, err)
+}
+
+func TestLoad_AcceptsOlderSchemaVersion(t *testing.T) {
+	const testconfig = `
+	cimple {
+		version = "0.0.1"
+	}
+	name = "test"
+	version = "0.0.1"
+	`
+
+	_, err := Load(testconfig)
+	assert.Nil(t, err)
+}
+
+func TestMigrate_UpdatesSchemaVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	const testconfig = `cimple {
+  version = "0.0.1"
+}
+
+name = "test"
+version = "0.0.1"
+
+task build {
+  script build {
+    body = <<BODY
+go build
+BODY
+  }
+}
+`
+
+	migrated, changes, err := Migrate(testconfig)
+	if assert.Nil(err) {
+		assert.Equal([]string{
+			"0.0.5: Labelled publish destinations with their type, bintray",
+			"Updated schema version from 0.0.1 to " + SchemaVersion,
+		}, changes)
+		assert.Contains(string(migrated), `version = "`+SchemaVersion+`"`)
+
+		cfg, err := Load(string(migrated))
+		if assert.Nil(err) {
+			assert.Equal("go build\n", cfg.Tasks["build"].Steps["build"].(Script).Body)
+		}
+	}
+}
+
+func TestMigrate_AppliesPendingMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	original := migrations
+	defer func() { migrations = original }()
+
+	migrations = []migration{
+		{
+			version:     "0.0.2",
+			description: "Renamed task summary to description",
+			apply: func(list *ast.ObjectList) error {
+				for _, task := range list.Filter("task").Items {
+					for _, item := range task.Val.(*ast.ObjectType).List.Items {
+						if item.Keys[0].Token.Text == "summary" {
+							item.Keys[0].Token.Text = "description"
+						}
+					}
+				}
+				return nil
+			},
+		},
+		{
+			version:     "0.0.1",
+			description: "Not applied",
+			apply: func(list *ast.ObjectList) error {
+				t.Fatal("Migration to an older version should not be applied")
+				return nil
+			},
+		},
+	}
+
+	const testconfig = `
+	cimple {
+		version = "0.0.1"
+	}
+	name = "test"
+	version = "0.0.1"
+	task build {
+		summary = "Builds things"
+	}
+	`
+
+	migrated, changes, err := Migrate(testconfig)
+	if assert.Nil(err) {
+		assert.Equal("0.0.2: Renamed task summary to description", changes[0])
+
+		cfg, err := Load(string(migrated))
+		if assert.Nil(err) {
+			assert.Equal("Builds things", cfg.Tasks["build"].Description)
+		}
+	}
+}
+
+func TestMigrate_LabelsBintrayDestinations(t *testing.T) {
+	assert := assert.New(t)
+
+	const testconfig = `
+	cimple {
+		version = "0.0.4"
+	}
+	name = "test"
+	version = "0.0.1"
+	task publish {
+		publish binaries {
+			destination {
+				subject = "cimpleci"
+				repository = "pkgs"
+				package = "cimple"
+				username = "lukesmith"
+			}
+			destination packages {
+				subject = "cimpleci"
+				repository = "debian"
+				package = "cimple"
+				username = "lukesmith"
+			}
+			files = ["output/*.tar.gz"]
+		}
+	}
+	`
+
+	migrated, _, err := Migrate(testconfig)
+	if assert.Nil(err) {
+		cfg, err := Load(string(migrated))
+		if assert.Nil(err) {
+			step := cfg.Tasks["publish"].Steps["binaries"].(PublishStep)
+			if assert.Len(step.Destinations, 2) {
+				assert.IsType(&bintrayPublishDestination{}, step.Destinations[0])
+				assert.IsType(&bintrayPublishDestination{}, step.Destinations[1])
+			}
+		}
+	}
+}
+
+func TestMigrate_CurrentSchemaIsUnchanged(t *testing.T) {
+	const testconfig = `
+	cimple {
+		version = "` + SchemaVersion + `"
+	}
+	name = "test"
+	version = "0.0.1"
+	`
+
+	migrated, changes, err := Migrate(testconfig)
+	if assert.Nil(t, err) {
+		assert.Empty(t, changes)
+		assert.Equal(t, testconfig, string(migrated))
+	}
+}
+
+func TestLoadConfig_RejectsNewerSchemaVersionInInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cimple-schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	library := filepath.Join(dir, "library.hcl")
+	writeFile(t, library, `
+	cimple {
+		version = "99.0.0"
+	}
+	`)
+	writeFile(t, filepath.Join(dir, "cimple.hcl"), `
+	name = "test"
+	version = "0.0.1"
+	include library {
+		path = "library.hcl"
+	}
+	`)
+
+	_, err = LoadConfig(filepath.Join(dir, "cimple.hcl"))
+	if assert.IsType(t, &ConfigError{}, err) {
+		assert.Contains(t, err.Error(), "Include "+library+" - Schema version 99.0.0 is newer than the supported version")
+	}
+}
+
+func TestLoadConfig_MigratesIncludes(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "cimple-schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "library.hcl"), `
+	cimple {
+		version = "0.0.4"
+	}
+	task publish {
+		publish binaries {
+			destination {
+				subject = "cimpleci"
+				repository = "pkgs"
+				package = "cimple"
+				username = "lukesmith"
+			}
+			files = ["output/*.tar.gz"]
+		}
+	}
+	`)
+	writeFile(t, filepath.Join(dir, "cimple.hcl"), `
+	name = "test"
+	version = "0.0.1"
+	include library {
+		path = "library.hcl"
+	}
+	`)
+
+	cfg, err := LoadConfig(filepath.Join(dir, "cimple.hcl"))
+	if assert.Nil(err) {
+		step := cfg.Tasks["publish"].Steps["binaries"].(PublishStep)
+		if assert.Len(step.Destinations, 1) {
+			assert.IsType(&bintrayPublishDestination{}, step.Destinations[0])
+		}
+	}
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
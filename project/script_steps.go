@@ -1,14 +1,13 @@
 package project
 
 import (
-	"bytes"
 	"encoding/json"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	exec "os/exec"
-	"text/template"
+	"path/filepath"
+	"strings"
 
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
@@ -22,6 +21,10 @@ func (st ScriptStepParser) GetToken() string {
 	return "script"
 }
 
+func (st ScriptStepParser) GetAttributes() []string {
+	return []string{"body", "interpreter", "working_dir", "env", "skip", "when", "always", "allow_failure", "timeout", "retry"}
+}
+
 func (st ScriptStepParser) Parse(item *ast.ObjectItem) (Step, error) {
 	var m map[string]interface{}
 	if err := hcl.DecodeObject(&m, item.Val); err != nil {
@@ -29,12 +32,12 @@ func (st ScriptStepParser) Parse(item *ast.ObjectItem) (Step, error) {
 	}
 
 	delete(m, "env")
+	delete(m, "retry")
 
 	name := item.Keys[0].Token.Value().(string)
 	var c Script
 	c.Env = make(map[string]string)
 	if err := mapstructure.WeakDecode(m, &c); err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 
@@ -49,14 +52,32 @@ func (st ScriptStepParser) Parse(item *ast.ObjectItem) (Step, error) {
 		return nil, err
 	}
 
+	if _, err := parseTimeout(c.Timeout); err != nil {
+		return nil, err
+	}
+
+	retry, err := parseRetry(listVal.Filter("retry"))
+	if err != nil {
+		return nil, err
+	}
+	c.Retry = retry
+
 	return c, nil
 }
 
 type Script struct {
 	name string
 	Skip bool
+	When string
 	Body string
-	Env  map[string]string
+	// Interpreter is the command, with any options, the script is passed to.
+	Interpreter  string
+	WorkingDir   string `mapstructure:"working_dir"`
+	Env          map[string]string
+	Timeout      string
+	Retry        Retry
+	Always       bool
+	AllowFailure bool `mapstructure:"allow_failure"`
 }
 
 func (s Script) GetName() string {
@@ -67,17 +88,47 @@ func (s Script) GetSkip() bool {
 	return s.Skip
 }
 
+func (s Script) GetWhen() string {
+	return s.When
+}
+
 func (s Script) GetEnv() map[string]string {
 	return s.Env
 }
 
+func (s Script) GetRetry() Retry {
+	return s.Retry
+}
+
+func (s Script) GetAlways() bool {
+	return s.Always
+}
+
+func (s Script) GetAllowFailure() bool {
+	return s.AllowFailure
+}
+
 func (s Script) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Body string
-		Skip bool
+		Body         string
+		Interpreter  string
+		WorkingDir   string
+		Skip         bool
+		When         string
+		Timeout      string
+		Retry        Retry
+		Always       bool
+		AllowFailure bool
 	}{
 		s.Body,
+		s.Interpreter,
+		s.WorkingDir,
 		s.Skip,
+		s.When,
+		s.Timeout,
+		s.Retry,
+		s.Always,
+		s.AllowFailure,
 	})
 }
 
@@ -86,9 +137,21 @@ func (s Script) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) error
 	if err != nil {
 		return err
 	}
+	defer os.Remove(f)
+
+	interpreter := strings.Fields(s.Interpreter)
+	if len(interpreter) == 0 {
+		interpreter = []string{"/bin/sh"}
+	}
 
-	args := []string{f}
-	var cmd = exec.Command("/bin/sh", args...)
+	args := append(interpreter[1:], f)
+	var cmd = exec.Command(interpreter[0], args...)
+
+	dir, err := stepWorkingDir(s.name, s.WorkingDir, vars)
+	if err != nil {
+		return err
+	}
+	cmd.Dir = dir
 
 	// Clear out env for command so not to inherit current process's environment.
 	cmd.Env = []string{}
@@ -105,7 +168,12 @@ func (s Script) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) error
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
-	err = cmd.Run()
+	timeout, err := parseTimeout(s.Timeout)
+	if err != nil {
+		return err
+	}
+
+	err = runProcess(cmd, timeout, vars.Cancel)
 	if err != nil {
 		return err
 	}
@@ -114,35 +182,38 @@ func (s Script) Execute(vars StepVars, stdout io.Writer, stderr io.Writer) error
 }
 
 func (s Script) templatedEnvs(vars StepVars) (map[string]string, error) {
-	env := make(map[string]string)
+	return renderEnvs(s.name, vars.Map(), vars)
+}
 
-	for k, v := range vars.Map() {
-		tmpl, err := template.New("t").Parse(v)
+func (s Script) writeFile(vars StepVars) (string, error) {
+	body, err := renderTemplate(s.name+".body", s.Body, vars)
+	if err != nil {
+		return "", err
+	}
+
+	// The script is referred to by an absolute path as the step may run
+	// within another directory.
+	dir := os.TempDir()
+	if len(vars.BuildDir) != 0 {
+		abs, err := filepath.Abs(filepath.Join(vars.BuildDir, "scripts"))
 		if err != nil {
-			return nil, err
+			return "", err
+		}
+		if err := os.MkdirAll(abs, 0755); err != nil {
+			return "", err
 		}
-		var doc bytes.Buffer
-		tmpl.Execute(&doc, vars)
-		env[k] = doc.String()
+		dir = abs
 	}
 
-	return env, nil
-}
-
-func (s Script) writeFile(vars StepVars) (string, error) {
-	f, _ := ioutil.TempFile(os.TempDir(), "step")
-	defer f.Close()
-
-	tmpl, err := template.New("t").Parse(s.Body)
+	f, err := ioutil.TempFile(dir, "step")
 	if err != nil {
 		return "", err
 	}
-	var doc bytes.Buffer
-	err = tmpl.Execute(&doc, vars)
-	if err != nil {
+	defer f.Close()
+
+	if _, err := f.WriteString(body); err != nil {
 		return "", err
 	}
-	f.WriteString(doc.String())
 
 	return f.Name(), nil
 }
@@ -0,0 +1,84 @@
+package project
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lukesmith/cimple/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScriptStepParser_InterpreterAndWorkingDir(t *testing.T) {
+	scriptHcl := `
+script example {
+	interpreter = "bash -euo pipefail"
+	working_dir = "services/api"
+	body = "make"
+}
+`
+	item, err := extractStep(scriptHcl, "script")
+	if assert.Nil(t, err) {
+		parser := &ScriptStepParser{}
+		step, err := parser.Parse(item)
+		if assert.Nil(t, err) {
+			script := step.(Script)
+			assert.Equal(t, "bash -euo pipefail", script.Interpreter)
+			assert.Equal(t, "services/api", script.WorkingDir)
+		}
+	}
+}
+
+func TestScript_Execute_InterpreterAndWorkingDir(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+
+	script := Script{
+		name:        "example",
+		Interpreter: "/bin/sh -e",
+		WorkingDir:  "sub",
+		Body:        "pwd\nfalse\necho unreachable",
+		Env:         map[string]string{},
+	}
+
+	vars := StepVars{
+		Cimple:     &env.CimpleEnvironment{},
+		WorkingDir: dir,
+		BuildDir:   filepath.Join(dir, ".cimple", "test", "1"),
+	}
+	var out bytes.Buffer
+	err = script.Execute(vars, &out, &out)
+
+	assert.NotNil(err)
+	assert.True(strings.HasSuffix(strings.TrimSpace(out.String()), "sub"), out.String())
+	assert.NotContains(out.String(), "unreachable")
+
+	scripts, _ := ioutil.ReadDir(filepath.Join(vars.BuildDir, "scripts"))
+	assert.Empty(scripts)
+}
+
+func TestScript_Execute_MissingWorkingDir(t *testing.T) {
+	script := Script{
+		name:       "example",
+		WorkingDir: "does-not-exist",
+		Body:       "true",
+		Env:        map[string]string{},
+	}
+
+	vars := StepVars{Cimple: &env.CimpleEnvironment{}, WorkingDir: os.TempDir()}
+	var out bytes.Buffer
+	err := script.Execute(vars, &out, &out)
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "does-not-exist")
+	}
+}
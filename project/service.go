@@ -0,0 +1,335 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	exec "os/exec"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	defaultReadyTimeout  = 30 * time.Second
+	defaultReadyInterval = 500 * time.Millisecond
+)
+
+// Service is a long running process started before the steps of a task and
+// stopped once the task completes.
+type Service struct {
+	Name       string
+	Command    string
+	Args       []string
+	WorkingDir string `mapstructure:"working_dir"`
+	Env        map[string]string
+	// Export are the environment variables made available to the steps of
+	// the task, e.g. connection strings.
+	Export map[string]string
+	Ready  *ReadinessCheck
+}
+
+// ReadinessCheck determines when a service is ready to be used. Only one of
+// Tcp, Http or Command is used.
+type ReadinessCheck struct {
+	Tcp      string
+	Http     string
+	Command  string
+	Timeout  string
+	Interval string
+}
+
+func parseServices(list *ast.ObjectList) ([]*Service, error) {
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+
+	services := []*Service{}
+	names := make(map[string]bool)
+
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			return nil, &ConfigError{
+				Issues: []string{"A service must have a name"},
+			}
+		}
+
+		var m map[string]interface{}
+		if err := hcl.DecodeObject(&m, item.Val); err != nil {
+			return nil, err
+		}
+
+		delete(m, "env")
+		delete(m, "export")
+		delete(m, "ready")
+
+		service := &Service{
+			Name:   item.Keys[0].Token.Value().(string),
+			Env:    make(map[string]string),
+			Export: make(map[string]string),
+		}
+		if err := mapstructure.WeakDecode(m, service); err != nil {
+			return nil, err
+		}
+
+		if names[service.Name] {
+			return nil, &ConfigError{
+				Issues: []string{fmt.Sprintf("A service named %s exists multiple times", service.Name)},
+			}
+		}
+		names[service.Name] = true
+
+		if len(service.Command) == 0 {
+			return nil, &ConfigError{
+				Issues: []string{fmt.Sprintf("Service %s must specify a command", service.Name)},
+			}
+		}
+
+		var listVal *ast.ObjectList
+		if ot, ok := item.Val.(*ast.ObjectType); ok {
+			listVal = ot.List
+		}
+
+		if err := parseEnvs(service.Env, listVal.Filter("env")); err != nil {
+			return nil, err
+		}
+
+		if err := parseEnvs(service.Export, listVal.Filter("export")); err != nil {
+			return nil, err
+		}
+
+		ready, err := parseReadinessCheck(service.Name, listVal.Filter("ready"))
+		if err != nil {
+			return nil, err
+		}
+		service.Ready = ready
+
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func parseReadinessCheck(service string, list *ast.ObjectList) (*ReadinessCheck, error) {
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+
+	if len(list.Items) > 1 {
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("Service %s can only contain a single ready block", service)},
+		}
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, list.Items[0].Val); err != nil {
+		return nil, err
+	}
+
+	ready := &ReadinessCheck{}
+	if err := mapstructure.WeakDecode(m, ready); err != nil {
+		return nil, err
+	}
+
+	checks := 0
+	for _, c := range []string{ready.Tcp, ready.Http, ready.Command} {
+		if len(c) != 0 {
+			checks++
+		}
+	}
+
+	if checks != 1 {
+		return nil, &ConfigError{
+			Issues: []string{fmt.Sprintf("The ready block of service %s must specify one of tcp, http or command", service)},
+		}
+	}
+
+	for _, d := range []string{ready.Timeout, ready.Interval} {
+		if _, err := parseTimeout(d); err != nil {
+			return nil, err
+		}
+	}
+
+	return ready, nil
+}
+
+// RunningService is a service which has been started.
+type RunningService struct {
+	Service *Service
+	cmd     *exec.Cmd
+	exited  chan error
+	// env is the rendered environment of the service, which readiness
+	// commands also run with.
+	env []string
+}
+
+// Start runs the service and waits for it to be ready. The service is stopped
+// if it does not become ready.
+func (s *Service) Start(vars StepVars, stdout io.Writer, stderr io.Writer) (*RunningService, error) {
+	args := []string{}
+	for i, a := range s.Args {
+		arg, err := renderTemplate(fmt.Sprintf("%s.args[%d]", s.Name, i), a, vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	vars.StepEnv = merge(vars.StepEnv, s.Env)
+	env, err := renderEnvs(s.Name, vars.Map(), vars)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(s.Command, args...)
+	cmd.Env = []string{}
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	dir, err := stepWorkingDir(s.Name, s.WorkingDir, vars)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Dir = dir
+
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Unable to start service %s - %s", s.Name, err)
+	}
+	trackProcess(cmd)
+
+	running := &RunningService{
+		Service: s,
+		cmd:     cmd,
+		exited:  make(chan error, 1),
+		env:     cmd.Env,
+	}
+	go func() {
+		running.exited <- cmd.Wait()
+	}()
+
+	if err := running.waitUntilReady(vars); err != nil {
+		running.Stop()
+		return nil, err
+	}
+
+	return running, nil
+}
+
+func (rs *RunningService) waitUntilReady(vars StepVars) error {
+	ready := rs.Service.Ready
+	if ready == nil {
+		return nil
+	}
+
+	timeout, _ := parseTimeout(ready.Timeout)
+	if timeout == 0 {
+		timeout = defaultReadyTimeout
+	}
+
+	interval, _ := parseTimeout(ready.Interval)
+	if interval == 0 {
+		interval = defaultReadyInterval
+	}
+
+	deadlineAt := time.Now().Add(timeout)
+	deadline := time.After(timeout)
+	for {
+		remaining := deadlineAt.Sub(time.Now())
+		if remaining <= 0 {
+			return fmt.Errorf("Service %s was not ready after %s", rs.Service.Name, timeout)
+		}
+
+		if err := ready.check(vars, rs.env, remaining); err == nil {
+			return nil
+		}
+
+		select {
+		case err := <-rs.exited:
+			rs.exited <- err
+			return fmt.Errorf("Service %s exited before it was ready - %v", rs.Service.Name, err)
+		case <-deadline:
+			return fmt.Errorf("Service %s was not ready after %s", rs.Service.Name, timeout)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// check runs the readiness check once. A readiness command runs with the
+// environment of the service and is killed once the timeout passes.
+func (r *ReadinessCheck) check(vars StepVars, env []string, timeout time.Duration) error {
+	switch {
+	case len(r.Tcp) != 0:
+		conn, err := net.DialTimeout("tcp", r.Tcp, time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case len(r.Http) != 0:
+		client := &http.Client{Timeout: time.Second}
+		res, err := client.Get(r.Http)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode >= 400 {
+			return fmt.Errorf("%s returned %d", r.Http, res.StatusCode)
+		}
+		return nil
+	default:
+		parts := strings.Fields(r.Command)
+		cmd := exec.Command(parts[0], parts[1:]...)
+		cmd.Dir = vars.WorkingDir
+		cmd.Env = env
+		return runProcess(cmd, timeout, nil)
+	}
+}
+
+// Exports returns the environment variables the service makes available to
+// the steps of the task.
+func (rs *RunningService) Exports() map[string]string {
+	prefix := "CIMPLE_SERVICE_" + strings.ToUpper(strings.Replace(rs.Service.Name, "-", "_", -1))
+	result := make(map[string]string)
+
+	if ready := rs.Service.Ready; ready != nil {
+		if len(ready.Tcp) != 0 {
+			result[prefix+"_ADDR"] = ready.Tcp
+			if host, port, err := net.SplitHostPort(ready.Tcp); err == nil {
+				result[prefix+"_HOST"] = host
+				result[prefix+"_PORT"] = port
+			}
+		}
+
+		if len(ready.Http) != 0 {
+			result[prefix+"_URL"] = ready.Http
+			if u, err := url.Parse(ready.Http); err == nil {
+				host, port, err := net.SplitHostPort(u.Host)
+				if err != nil {
+					host, port = u.Host, ""
+				}
+				result[prefix+"_HOST"] = strings.Trim(host, "[]")
+				result[prefix+"_PORT"] = port
+			}
+		}
+	}
+
+	return merge(result, rs.Service.Export)
+}
+
+// Stop kills the service along with any processes it has started. The process
+// group is killed even when the service has exited, as processes it forked
+// may still be running.
+func (rs *RunningService) Stop() {
+	killProcessGroup(rs.cmd)
+	untrackProcess(rs.cmd)
+	err := <-rs.exited
+	rs.exited <- err
+}
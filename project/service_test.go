@@ -0,0 +1,276 @@
+package project
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lukesmith/cimple/env"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServices(t *testing.T) {
+	assert := assert.New(t)
+
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+	task integration {
+		service api-stub {
+			command = "./bin/stub"
+			args = ["--port", "8081"]
+
+			env {
+				STUB_MODE = "strict"
+			}
+
+			export {
+				API_URL = "http://localhost:8081"
+			}
+
+			ready {
+				http = "http://localhost:8081/health"
+				timeout = "10s"
+			}
+		}
+	}
+	`
+
+	cfg, err := Load(testconfig)
+	if !assert.Nil(err) {
+		return
+	}
+
+	services := cfg.Tasks["integration"].Services
+	if assert.Len(services, 1) {
+		assert.Equal("api-stub", services[0].Name)
+		assert.Equal("./bin/stub", services[0].Command)
+		assert.Equal([]string{"--port", "8081"}, services[0].Args)
+		assert.Equal("strict", services[0].Env["STUB_MODE"])
+		assert.Equal("http://localhost:8081", services[0].Export["API_URL"])
+		assert.Equal("http://localhost:8081/health", services[0].Ready.Http)
+		assert.Equal("10s", services[0].Ready.Timeout)
+	}
+}
+
+func TestParseServices_ReadyRequiresASingleCheck(t *testing.T) {
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+	task integration {
+		service db {
+			command = "postgres"
+			ready {
+				tcp = "localhost:5432"
+				command = "pg_isready"
+			}
+		}
+	}
+	`
+
+	_, err := Load(testconfig)
+	assert.IsType(t, &ConfigError{}, err)
+}
+
+func TestService_StartWaitsForTcp(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	service := &Service{
+		Name:    "db",
+		Command: "sleep",
+		Args:    []string{"30"},
+		Ready:   &ReadinessCheck{Tcp: listener.Addr().String()},
+	}
+
+	rs, err := service.Start(StepVars{Cimple: &env.CimpleEnvironment{}}, ioutil.Discard, ioutil.Discard)
+	if !assert.Nil(err) {
+		return
+	}
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	exports := rs.Exports()
+	assert.Equal(listener.Addr().String(), exports["CIMPLE_SERVICE_DB_ADDR"])
+	assert.Equal("127.0.0.1", exports["CIMPLE_SERVICE_DB_HOST"])
+	assert.Equal(port, exports["CIMPLE_SERVICE_DB_PORT"])
+
+	rs.Stop()
+	assert.NotNil(rs.cmd.ProcessState)
+}
+
+func TestService_StartWaitsForCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	service := &Service{
+		Name:    "stub",
+		Command: "/bin/sh",
+		Args:    []string{"-c", "sleep 0.2; touch ready; sleep 30"},
+		Ready:   &ReadinessCheck{Command: "test -f ready", Interval: "50ms"},
+	}
+
+	vars := StepVars{Cimple: &env.CimpleEnvironment{}, WorkingDir: dir}
+	rs, err := service.Start(vars, ioutil.Discard, ioutil.Discard)
+	if assert.Nil(t, err) {
+		_, err := os.Stat(filepath.Join(dir, "ready"))
+		assert.Nil(t, err)
+		rs.Stop()
+	}
+}
+
+func TestService_StartFailsWhenServiceExits(t *testing.T) {
+	service := &Service{
+		Name:    "stub",
+		Command: "false",
+		Ready:   &ReadinessCheck{Command: "false", Interval: "10ms"},
+	}
+
+	_, err := service.Start(StepVars{Cimple: &env.CimpleEnvironment{}}, ioutil.Discard, ioutil.Discard)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "exited before it was ready")
+	}
+}
+
+func TestService_StartFailsWhenNotReady(t *testing.T) {
+	service := &Service{
+		Name:    "stub",
+		Command: "sleep",
+		Args:    []string{"30"},
+		Ready:   &ReadinessCheck{Command: "false", Timeout: "200ms", Interval: "10ms"},
+	}
+
+	_, err := service.Start(StepVars{Cimple: &env.CimpleEnvironment{}}, ioutil.Discard, ioutil.Discard)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "was not ready after 200ms")
+	}
+}
+
+func TestService_StartRunsReadinessCommandWithServiceEnv(t *testing.T) {
+	service := &Service{
+		Name:    "stub",
+		Command: "sleep",
+		Args:    []string{"30"},
+		Env:     map[string]string{"READY_FILE": "/"},
+		Ready:   &ReadinessCheck{Command: "printenv READY_FILE", Timeout: "2s", Interval: "10ms"},
+	}
+
+	rs, err := service.Start(StepVars{Cimple: &env.CimpleEnvironment{}}, ioutil.Discard, ioutil.Discard)
+	if assert.Nil(t, err) {
+		rs.Stop()
+	}
+}
+
+func TestService_StartKillsHungReadinessCommand(t *testing.T) {
+	service := &Service{
+		Name:    "stub",
+		Command: "sleep",
+		Args:    []string{"30"},
+		Ready:   &ReadinessCheck{Command: "sleep 30", Timeout: "200ms", Interval: "10ms"},
+	}
+
+	start := time.Now()
+	_, err := service.Start(StepVars{Cimple: &env.CimpleEnvironment{}}, ioutil.Discard, ioutil.Discard)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "was not ready after 200ms")
+	}
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestService_StopKillsProcessesOfAnExitedService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	service := &Service{
+		Name:    "stub",
+		Command: "/bin/sh",
+		Args:    []string{"-c", "sleep 30 >/dev/null 2>&1 & echo $! > child"},
+	}
+
+	vars := StepVars{Cimple: &env.CimpleEnvironment{}, WorkingDir: dir}
+	rs, err := service.Start(vars, ioutil.Discard, ioutil.Discard)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// Wait for the service itself to exit, leaving the child running
+	err = <-rs.exited
+	rs.exited <- err
+
+	pid, err := ioutil.ReadFile(filepath.Join(dir, "child"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	rs.Stop()
+
+	assert.False(t, processRunning(strings.TrimSpace(string(pid))), "Expected the child of the service to be killed")
+}
+
+func TestKillProcesses_KillsRunningServices(t *testing.T) {
+	defer func() { processes.killed = false }()
+
+	service := &Service{Name: "stub", Command: "sleep", Args: []string{"30"}}
+
+	rs, err := service.Start(StepVars{Cimple: &env.CimpleEnvironment{}}, ioutil.Discard, ioutil.Discard)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer rs.Stop()
+
+	KillProcesses()
+
+	select {
+	case err := <-rs.exited:
+		rs.exited <- err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the service to be killed")
+	}
+
+	late, err := service.Start(StepVars{Cimple: &env.CimpleEnvironment{}}, ioutil.Discard, ioutil.Discard)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer late.Stop()
+
+	select {
+	case err := <-late.exited:
+		late.exited <- err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a service started after the processes were killed to be killed")
+	}
+}
+
+// processRunning reports whether the process is alive, waiting briefly for a
+// killed process to exit. Zombies are not running.
+func processRunning(pid string) bool {
+	for i := 0; i < 100; i++ {
+		stat, err := ioutil.ReadFile(filepath.Join("/proc", pid, "stat"))
+		if err != nil {
+			return false
+		}
+
+		fields := strings.Fields(string(stat))
+		if len(fields) > 2 && fields[2] == "Z" {
+			return false
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return true
+}
@@ -0,0 +1,158 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Version is a semantic version as returned by the semver template function.
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Metadata   string
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) != 0 {
+		s = s + "-" + v.Prerelease
+	}
+	if len(v.Metadata) != 0 {
+		s = s + "+" + v.Metadata
+	}
+	return s
+}
+
+// ParseVersion parses a semantic version in the form major.minor.patch with
+// an optional -prerelease and +metadata.
+func ParseVersion(s string) (Version, error) {
+	v := Version{}
+	rest := strings.TrimPrefix(s, "v")
+
+	if i := strings.Index(rest, "+"); i != -1 {
+		v.Metadata = rest[i+1:]
+		rest = rest[:i]
+	}
+
+	if i := strings.Index(rest, "-"); i != -1 {
+		v.Prerelease = rest[i+1:]
+		rest = rest[:i]
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("%s is not a semantic version", s)
+	}
+
+	numbers := []int{}
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("%s is not a semantic version", s)
+		}
+		numbers = append(numbers, n)
+	}
+
+	v.Major, v.Minor, v.Patch = numbers[0], numbers[1], numbers[2]
+
+	return v, nil
+}
+
+// templateFuncs returns the functions available within templates. Paths are
+// relative to the working directory of the build.
+func templateFuncs(vars StepVars) template.FuncMap {
+	path := func(p string) string {
+		if filepath.IsAbs(p) || len(vars.WorkingDir) == 0 {
+			return p
+		}
+		return filepath.Join(vars.WorkingDir, p)
+	}
+
+	return template.FuncMap{
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      strings.Title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix string, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old string, new string, s string) string { return strings.Replace(s, old, new, -1) },
+		"contains":   func(substr string, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix string, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix string, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep string, s string) []string { return strings.Split(s, sep) },
+		"join":       func(sep string, a []string) string { return strings.Join(a, sep) },
+		"default": func(d interface{}, v interface{}) interface{} {
+			if v == nil || fmt.Sprintf("%v", v) == "" {
+				return d
+			}
+			return v
+		},
+		"env": func(name string) string {
+			return vars.HostEnv[name]
+		},
+		"file": func(p string) (string, error) {
+			d, err := ioutil.ReadFile(path(p))
+			return string(d), err
+		},
+		"glob": func(pattern string) ([]string, error) {
+			return filepath.Glob(path(pattern))
+		},
+		"sha256file": func(p string) (string, error) {
+			return sha256File(path(p))
+		},
+		"semver": ParseVersion,
+		"secret": func(t string, key string) (string, error) {
+			if vars.Secrets == nil {
+				return "", fmt.Errorf("No secrets are available to retrieve %s %s", t, key)
+			}
+			return vars.Secrets.Get(t, key)
+		},
+	}
+}
+
+func parseTemplate(name string, text string, vars StepVars) (*template.Template, error) {
+	tmpl := template.New(name).Funcs(templateFuncs(vars))
+	if vars.Project.StrictTemplates {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+
+	return tmpl.Parse(text)
+}
+
+// renderTemplate renders text using the step variables. Errors identify the
+// template by name along with the position of the failure.
+func renderTemplate(name string, text string, vars StepVars) (string, error) {
+	tmpl, err := parseTemplate(name, text, vars)
+	if err != nil {
+		return "", err
+	}
+
+	var doc bytes.Buffer
+	if err := tmpl.Execute(&doc, vars); err != nil {
+		return "", err
+	}
+
+	return doc.String(), nil
+}
+
+// renderEnvs renders each of the values within env.
+func renderEnvs(name string, env map[string]string, vars StepVars) (map[string]string, error) {
+	result := make(map[string]string)
+
+	for k, v := range env {
+		rendered, err := renderTemplate(fmt.Sprintf("%s.env.%s", name, k), v, vars)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = rendered
+	}
+
+	return result, nil
+}
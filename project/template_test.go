@@ -0,0 +1,109 @@
+package project
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lukesmith/cimple/env"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSecretStore struct {
+	secrets map[string]string
+}
+
+func (s *fakeSecretStore) Get(t string, k string) (string, error) {
+	return s.secrets[t+":"+k], nil
+}
+
+func Test_renderTemplate_Functions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "VERSION"), []byte("hello"), 0644)
+
+	vars := StepVars{
+		Cimple:     &env.CimpleEnvironment{},
+		Project:    Project{Version: "1.2.3-beta+abc"},
+		WorkingDir: dir,
+		HostEnv:    map[string]string{"HOME": "/root"},
+		Secrets:    &fakeSecretStore{secrets: map[string]string{"bintray:cimple": "pa55"}},
+	}
+
+	cases := map[string]string{
+		`{{ "Cimple" | upper }}`:                "CIMPLE",
+		`{{ "Cimple" | lower }}`:                "cimple",
+		`{{ replace "-" "_" "a-b-c" }}`:         "a_b_c",
+		`{{ "v1.0" | trimPrefix "v" }}`:         "1.0",
+		`{{ split "," "a,b" | join "+" }}`:      "a+b",
+		`{{ contains "imp" "cimple" }}`:         "true",
+		`{{ env "HOME" }}`:                      "/root",
+		`{{ env "MISSING" | default "none" }}`:  "none",
+		`{{ file "VERSION" }}`:                  "hello",
+		`{{ glob "VERS*" | len }}`:              "1",
+		`{{ sha256file "VERSION" }}`:            "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		`{{ (semver .Project.Version).Minor }}`: "2",
+		`{{ with semver .Project.Version }}{{ .Prerelease }}/{{ .Metadata }}{{ end }}`: "beta/abc",
+		`{{ secret "bintray" "cimple" }}`:                                              "pa55",
+	}
+
+	for text, expected := range cases {
+		actual, err := renderTemplate("t", text, vars)
+		if assert.Nil(t, err, text) {
+			assert.Equal(t, expected, actual, text)
+		}
+	}
+}
+
+func Test_renderTemplate_StrictMissingKey(t *testing.T) {
+	vars := StepVars{
+		Cimple:  &env.CimpleEnvironment{},
+		HostEnv: map[string]string{},
+	}
+
+	actual, err := renderTemplate("build.body", "echo {{ .HostEnv.MISSING }}", vars)
+	assert.Nil(t, err)
+	assert.Equal(t, "echo <no value>", actual)
+
+	vars.Project.StrictTemplates = true
+	_, err = renderTemplate("build.body", "echo {{ .HostEnv.MISSING }}", vars)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "build.body:1:")
+		assert.Contains(t, err.Error(), "MISSING")
+	}
+}
+
+func TestCommand_Execute_TemplateError(t *testing.T) {
+	command := Command{
+		name:    "echo",
+		Command: "echo",
+		Args:    []string{`{{ file "does-not-exist" }}`},
+		Env:     map[string]string{},
+	}
+
+	vars := StepVars{Cimple: &env.CimpleEnvironment{}}
+	var out bytes.Buffer
+	err := command.Execute(vars, &out, &out)
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "echo.args[0]")
+	}
+}
+
+func TestStrictTemplates(t *testing.T) {
+	const testconfig = `
+	name = "test"
+	version = "0.0.1"
+	strict_templates = true
+	`
+
+	cfg, err := Load(testconfig)
+	if assert.Nil(t, err) {
+		assert.True(t, cfg.Project.StrictTemplates)
+	}
+}
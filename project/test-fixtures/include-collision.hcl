@@ -0,0 +1,17 @@
+cimple {
+  version = "0.0.1"
+}
+
+name = "Cimple"
+description = "Testing includes with colliding task names"
+version = "0.0.1"
+
+include library {
+  path = "include-library.hcl"
+}
+
+task "test" {
+  script "gotest" {
+    body = "go test -v ./..."
+  }
+}
@@ -0,0 +1,16 @@
+env {
+  library_env = "library"
+  shared_env = "library"
+}
+
+task "fix" {
+  script "gofmt" {
+    body = "go fmt ./..."
+  }
+}
+
+task "test" {
+  script "gotest" {
+    body = "go test ./..."
+  }
+}
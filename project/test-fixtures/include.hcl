@@ -0,0 +1,27 @@
+cimple {
+  version = "0.0.1"
+}
+
+name = "Cimple"
+description = "Testing includes"
+version = "0.0.1"
+
+include library {
+  path = "include-library.hcl"
+}
+
+env {
+  shared_env = "project"
+}
+
+task "test" {
+  override = true
+
+  script "gotest" {
+    body = "go test -v ./..."
+  }
+}
+
+task "package" {
+  depends = ["fix", "test"]
+}
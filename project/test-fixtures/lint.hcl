@@ -0,0 +1,40 @@
+cimple {
+  version = "0.0.1"
+}
+
+name = "Cimple"
+version = "0.0.1"
+
+task build {
+  depends = ["missing", "test"]
+  limit_to = "cloud"
+
+  script compile {
+    body = "go build {{ .Project.Name"
+    shell = "bash"
+  }
+
+  command Bad {
+    command = "echo"
+  }
+}
+
+task test {
+  depends = ["build"]
+  when = "eq .Vcs.Branch )"
+
+  command vet {
+    command = "go"
+    args = ["vet"]
+    timeout = "soon"
+  }
+
+  parallel checks {
+    fail_fast = true
+
+    command vet {
+      command = "go"
+      timeout = "later"
+    }
+  }
+}
@@ -0,0 +1,27 @@
+cimple {
+  version = "0.0.1"
+}
+
+name = "Cimple"
+description = "Testing matrix expansion"
+version = "0.0.1"
+
+task "test" {
+  matrix {
+    go = ["1.7", "1.8"]
+    goos = ["linux", "darwin"]
+    fail_fast = false
+  }
+
+  script "gotest" {
+    body = "go test ./..."
+  }
+}
+
+task "package" {
+  depends = ["test"]
+
+  script "build" {
+    body = "go build"
+  }
+}
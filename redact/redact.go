@@ -0,0 +1,182 @@
+package redact
+
+import (
+	"encoding/base64"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask replaces secret values.
+const Mask = "****"
+
+// Redactor masks secret values, along with their base64 encoded forms, within
+// text. Secrets can be added at any time.
+type Redactor struct {
+	mu       sync.RWMutex
+	secrets  map[string]bool
+	values   []string
+	replacer *strings.Replacer
+}
+
+func New() *Redactor {
+	return &Redactor{
+		secrets:  make(map[string]bool),
+		values:   []string{},
+		replacer: strings.NewReplacer(),
+	}
+}
+
+// Add registers a secret to be masked.
+func (r *Redactor) Add(secret string) {
+	if len(secret) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.secrets[secret] {
+		return
+	}
+	r.secrets[secret] = true
+
+	for _, v := range variants(secret) {
+		r.values = append(r.values, v)
+	}
+
+	// The replacer prefers earlier values, so longer values are masked in
+	// full before a shorter value they contain.
+	sort.Stable(byLengthDescending(r.values))
+
+	pairs := []string{}
+	for _, v := range r.values {
+		pairs = append(pairs, v, Mask)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact masks the secrets within s.
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.replacer.Replace(s)
+}
+
+// RedactMap masks the secrets within the values of m.
+func (r *Redactor) RedactMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	result := make(map[string]string)
+	for k, v := range m {
+		result[k] = r.Redact(v)
+	}
+	return result
+}
+
+// held returns the length of the longest suffix of s which is the start of a
+// secret, and so may be completed by a later write.
+func (r *Redactor) held(s string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	held := 0
+	for _, v := range r.values {
+		for l := len(v) - 1; l > held; l-- {
+			if l <= len(s) && strings.HasSuffix(s, v[:l]) {
+				held = l
+				break
+			}
+		}
+	}
+	return held
+}
+
+// variants returns the forms of a secret which are masked. Along with the
+// secret itself these are its base64 encodings, including those where the
+// secret is part of a larger encoded value, e.g. a basic auth header.
+func variants(secret string) []string {
+	result := []string{secret}
+
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding} {
+		for offset := 0; offset < 3; offset++ {
+			encoded := encoding.EncodeToString(append(make([]byte, offset), secret...))
+
+			// Only the characters determined entirely by the secret are kept.
+			start := (offset*8 + 5) / 6
+			end := (offset + len(secret)) * 8 / 6
+			if end-start >= 4 {
+				result = append(result, encoded[start:end])
+			}
+		}
+	}
+
+	unique := []string{}
+	seen := make(map[string]bool)
+	for _, v := range result {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+
+	return unique
+}
+
+// Writer masks secrets written to the underlying writer. Text which may be
+// the start of a secret is held back until the following write, so secrets
+// split across writes are masked. Flush must be called once writing is
+// complete.
+type Writer struct {
+	mu       sync.Mutex
+	redactor *Redactor
+	w        io.Writer
+	pending  string
+}
+
+// Writer creates a Writer which masks secrets written to w.
+func (r *Redactor) Writer(w io.Writer) *Writer {
+	return &Writer{
+		redactor: r,
+		w:        w,
+	}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	redacted := w.redactor.Redact(w.pending + string(p))
+	held := w.redactor.held(redacted)
+	w.pending = redacted[len(redacted)-held:]
+
+	if _, err := io.WriteString(w.w, redacted[:len(redacted)-held]); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Flush writes any text held back.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	_, err := io.WriteString(w.w, w.redactor.Redact(w.pending))
+	w.pending = ""
+	return err
+}
+
+type byLengthDescending []string
+
+func (s byLengthDescending) Len() int           { return len(s) }
+func (s byLengthDescending) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLengthDescending) Less(i, j int) bool { return len(s[i]) > len(s[j]) }
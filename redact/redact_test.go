@@ -0,0 +1,61 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	assert := assert.New(t)
+
+	r := New()
+	r.Add("hunter2")
+	r.Add("hunter22")
+	r.Add("")
+
+	assert.Equal("password is ****", r.Redact("password is hunter2"))
+	assert.Equal("password is ****!", r.Redact("password is hunter22!"))
+	assert.Equal("nothing to hide", r.Redact("nothing to hide"))
+}
+
+func TestRedactor_RedactsBase64(t *testing.T) {
+	assert := assert.New(t)
+
+	r := New()
+	r.Add("s3cret-value")
+
+	assert.NotContains(r.Redact(base64.StdEncoding.EncodeToString([]byte("s3cret-value"))), "czNjcmV0")
+
+	for _, prefix := range []string{"a:", "ab:", "abc:"} {
+		header := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(prefix+"s3cret-value"))
+		redacted := r.Redact(header)
+		assert.Contains(redacted, Mask, header)
+		assert.NotEqual(header, redacted)
+	}
+}
+
+func TestWriter_RedactsAcrossWrites(t *testing.T) {
+	assert := assert.New(t)
+
+	r := New()
+	r.Add("hunter2")
+
+	var out bytes.Buffer
+	w := r.Writer(&out)
+
+	for _, s := range []string{"the password is hun", "te", "r2 and h", "ello."} {
+		n, err := w.Write([]byte(s))
+		assert.Nil(err)
+		assert.Equal(len(s), n)
+	}
+	assert.Equal("the password is **** and hello.", out.String())
+
+	w.Write([]byte("ends with hunt"))
+	assert.Equal("the password is **** and hello.ends with ", out.String())
+
+	assert.Nil(w.Flush())
+	assert.Equal("the password is **** and hello.ends with hunt", out.String())
+}
@@ -5,8 +5,11 @@ import (
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/lukesmith/cimple/build"
+	"github.com/lukesmith/cimple/cache"
 	"github.com/lukesmith/cimple/journal"
 	"github.com/lukesmith/cimple/project"
 	"github.com/lukesmith/cimple/vcs"
@@ -19,6 +22,25 @@ type RunOptions struct {
 	Journal *JournalSettings
 	Context string
 	Secrets project.SecretStore
+	BuildId string
+	// Params are the values supplied for task params, keyed by task name.
+	Params map[string]map[string]string
+	// CacheDir is the directory task caches are stored in. Defaults to
+	// .cimple/.cache within the working directory.
+	CacheDir string
+	// CacheSize is the size in bytes the cache may grow to before entries are
+	// evicted.
+	CacheSize int64
+	// DryRunPublish lists the files publish steps would publish rather than
+	// publishing them.
+	DryRunPublish bool
+	// Parallel is the number of tasks which may run at the same time.
+	Parallel int
+	// Resume is the id of a build to resume. Tasks which succeeded in the
+	// build are not run again.
+	Resume string
+	// ResumeLast resumes the most recent build of the project.
+	ResumeLast bool
 }
 
 type JournalSettings struct {
@@ -27,8 +49,6 @@ type JournalSettings struct {
 }
 
 func Run(options *RunOptions, explicitTasks []string) error {
-	buildId := buildId()
-
 	cfg, err := loadConfig()
 	if err != nil {
 		return err
@@ -36,7 +56,19 @@ func Run(options *RunOptions, explicitTasks []string) error {
 
 	projectName := cfg.Project.Name
 
-	fileWriter, err := createOutputPathWriter(projectName, buildId)
+	buildId, resume, err := resumeBuild(options, projectName)
+	if err != nil {
+		return err
+	}
+
+	if len(buildId) == 0 {
+		buildId = options.BuildId
+	}
+	if len(buildId) == 0 {
+		buildId = NewBuildId()
+	}
+
+	fileWriter, err := createOutputPathWriter(projectName, buildId, resume != nil)
 	if err != nil {
 		return err
 	}
@@ -67,6 +99,15 @@ func Run(options *RunOptions, explicitTasks []string) error {
 	buildConfig.ExplicitTasks = explicitTasks
 	buildConfig.RunContext = options.Context
 	buildConfig.Secrets = options.Secrets
+	buildConfig.ArtifactsPath = artifactsPath(projectName, buildId)
+	buildConfig.BuildPath = cimplePath(projectName, buildId)
+	buildConfig.Params = options.Params
+	buildConfig.Cache = cache.NewStore(cacheDir(options.CacheDir), options.CacheSize)
+	buildConfig.DryRunPublish = options.DryRunPublish
+	buildConfig.Parallel = options.Parallel
+	buildConfig.Resume = resume
+
+	defer handleInterrupts(logWriter)()
 
 	err = executeBuild(buildConfig)
 	if err != nil {
@@ -76,6 +117,34 @@ func Run(options *RunOptions, explicitTasks []string) error {
 	return nil
 }
 
+var killProcesses = project.KillProcesses
+
+var exit = os.Exit
+
+// handleInterrupts stops the build when cimple receives SIGINT or SIGTERM,
+// killing its steps and services, which run in their own process groups and so
+// would otherwise keep running. The returned func stops handling the signals.
+func handleInterrupts(w io.Writer) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(w, "Received %s. Stopping the build\n", sig)
+			killProcesses()
+			exit(1)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
 var loadRepositoryInfo = func() *vcs.VcsInformation {
 	r, err := vcs.LoadVcsInformation()
 	if err != nil {
@@ -103,11 +172,72 @@ var executeBuild = func(buildConfig *build.BuildConfig) error {
 	return nil
 }
 
-func buildId() string {
+// resumeBuild returns the id and state of the build to resume, if any.
+func resumeBuild(options *RunOptions, projectName string) (string, *build.BuildState, error) {
+	if len(options.Resume) == 0 && !options.ResumeLast {
+		return "", nil, nil
+	}
+
+	if len(options.Resume) != 0 && options.ResumeLast {
+		return "", nil, fmt.Errorf("Only one of resume and resume-last can be specified")
+	}
+
+	buildId := options.Resume
+	if options.ResumeLast {
+		last, err := lastBuildId(projectName)
+		if err != nil {
+			return "", nil, err
+		}
+		buildId = last
+	}
+
+	if len(options.BuildId) != 0 && options.BuildId != buildId {
+		return "", nil, fmt.Errorf("A resumed build keeps its id of %s", buildId)
+	}
+
+	state, err := build.LoadBuildState(cimplePath(projectName, buildId))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return buildId, state, nil
+}
+
+// lastBuildId returns the id of the build of the project whose state was most
+// recently recorded.
+func lastBuildId(projectName string) (string, error) {
+	states, err := filepath.Glob(filepath.Join(cimplePath(projectName, "*"), build.StateFile))
+	if err != nil {
+		return "", err
+	}
+
+	var last string
+	var lastModified time.Time
+	for _, s := range states {
+		info, err := os.Stat(s)
+		if err != nil {
+			return "", err
+		}
+
+		if len(last) == 0 || info.ModTime().After(lastModified) {
+			last = filepath.Base(filepath.Dir(s))
+			lastModified = info.ModTime()
+		}
+	}
+
+	if len(last) == 0 {
+		return "", fmt.Errorf("There are no builds of %s to resume", projectName)
+	}
+
+	return last, nil
+}
+
+// NewBuildId creates an id for a build based on the current time.
+func NewBuildId() string {
 	return fmt.Sprintf("%v", time.Now().UnixNano())
 }
 
-func createOutputPathWriter(projectName string, buildId string) (*os.File, error) {
+func createOutputPathWriter(projectName string, buildId string, resume bool) (*os.File, error) {
 	path := outputPath(projectName, buildId)
 	dir := filepath.Dir(path)
 	err := os.MkdirAll(dir, 0755)
@@ -115,7 +245,13 @@ func createOutputPathWriter(projectName string, buildId string) (*os.File, error
 		return nil, err
 	}
 
-	fileWriter, err := os.Create(outputPath(projectName, buildId))
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		// Keep the output of the earlier runs of a resumed build
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	fileWriter, err := os.OpenFile(path, flags, 0666)
 	if err != nil {
 		return nil, err
 	}
@@ -123,10 +259,22 @@ func createOutputPathWriter(projectName string, buildId string) (*os.File, error
 	return fileWriter, nil
 }
 
+func cacheDir(dir string) string {
+	if len(dir) != 0 {
+		return dir
+	}
+
+	return path.Join(".cimple", ".cache")
+}
+
 func journalPath(projectName string, runId string) string {
 	return path.Join(cimplePath(projectName, runId), "journal")
 }
 
+func artifactsPath(projectName string, runId string) string {
+	return path.Join(cimplePath(projectName, runId), "artifacts")
+}
+
 func outputPath(projectName string, runId string) string {
 	return path.Join(cimplePath(projectName, runId), "output")
 }
@@ -1,11 +1,17 @@
 package runner
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
 	"github.com/lukesmith/cimple/build"
 	"github.com/lukesmith/cimple/project"
 	"github.com/lukesmith/cimple/vcs"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 func TestRun_ExplicitTasks(t *testing.T) {
@@ -67,3 +73,86 @@ func TestRun_RunContext(t *testing.T) {
 
 	assert.Equal(options.Context, executedConfig.RunContext)
 }
+
+func TestRun_ResumeLast(t *testing.T) {
+	assert := assert.New(t)
+	var executedConfig *build.BuildConfig
+
+	loadConfig = func() (*project.Config, error) {
+		return &project.Config{
+			Project: project.Project{Name: "resume"},
+			Tasks: map[string]*project.Task{
+				"one": &project.Task{Name: "one"},
+			},
+		}, nil
+	}
+
+	loadRepositoryInfo = func() *vcs.VcsInformation {
+		return new(vcs.VcsInformation)
+	}
+
+	executeBuild = func(buildConfig *build.BuildConfig) error {
+		executedConfig = buildConfig
+		return nil
+	}
+
+	defer os.RemoveAll(cimplePath("resume", ""))
+	for i, id := range []string{"1", "2"} {
+		dir := cimplePath("resume", id)
+		os.MkdirAll(dir, 0755)
+		ioutil.WriteFile(filepath.Join(dir, build.StateFile), []byte(`{"Tasks": {"one": {"Status": "successful"}}}`), 0644)
+		modified := time.Now().Add(time.Duration(i) * time.Minute)
+		os.Chtimes(filepath.Join(dir, build.StateFile), modified, modified)
+	}
+
+	options := &RunOptions{
+		Journal:    &JournalSettings{},
+		ResumeLast: true,
+	}
+	err := Run(options, []string{})
+
+	if assert.Nil(err) {
+		assert.Equal("2", executedConfig.BuildId)
+		assert.True(executedConfig.Resume.Succeeded("one"))
+	}
+}
+
+func TestRun_ResumeRequiresRecordedState(t *testing.T) {
+	loadConfig = func() (*project.Config, error) {
+		return &project.Config{Project: project.Project{Name: "resume"}}, nil
+	}
+
+	options := &RunOptions{
+		Journal: &JournalSettings{},
+		Resume:  "missing",
+	}
+	err := Run(options, []string{})
+
+	assert.EqualError(t, err, "No state was recorded for the build in .cimple/resume/missing")
+}
+
+func TestHandleInterrupts_KillsProcessesAndExits(t *testing.T) {
+	killed := false
+	killProcesses = func() { killed = true }
+	defer func() { killProcesses = project.KillProcesses }()
+
+	exited := make(chan int, 1)
+	exit = func(code int) { exited <- code }
+	defer func() { exit = os.Exit }()
+
+	var out bytes.Buffer
+	stop := handleInterrupts(&out)
+	defer stop()
+
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(os.Interrupt)
+
+	select {
+	case code := <-exited:
+		assert.Equal(t, 1, code)
+		assert.True(t, killed)
+		assert.Equal(t, "Received interrupt. Stopping the build\n", out.String())
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the build to be stopped")
+	}
+}
@@ -0,0 +1,250 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const fileFormatVersion = 1
+
+// Scrypt parameters used to derive the encryption key from the passphrase.
+const (
+	scryptN      = 32768
+	scryptR      = 8
+	scryptP      = 1
+	keyLength    = 32
+	saltLength   = 16
+	minKeyLength = 8
+)
+
+// Entry identifies a secret within a store.
+type Entry struct {
+	Type string
+	Key  string
+}
+
+// encryptedFile is the format of the secrets file on disk.
+type encryptedFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// FileStore is a secret store held within a file encrypted with a key
+// derived from a passphrase.
+type FileStore struct {
+	path       string
+	passphrase []byte
+	secrets    map[string]map[string]string
+}
+
+// OpenFileStore decrypts the secrets file at path. A store which does not
+// exist yet is empty until saved.
+func OpenFileStore(path string, passphrase []byte) (*FileStore, error) {
+	if len(passphrase) < minKeyLength {
+		return nil, fmt.Errorf("The secrets key must be at least %d characters", minKeyLength)
+	}
+
+	store := &FileStore{
+		path:       path,
+		passphrase: passphrase,
+		secrets:    make(map[string]map[string]string),
+	}
+
+	d, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file encryptedFile
+	if err := json.Unmarshal(d, &file); err != nil {
+		return nil, fmt.Errorf("Unable to read secrets file %s - %s", path, err)
+	}
+
+	if file.Version != fileFormatVersion {
+		return nil, fmt.Errorf("Secrets file %s has unsupported version %d", path, file.Version)
+	}
+
+	gcm, err := newCipher(passphrase, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt secrets file %s. Check the secrets key is correct", path)
+	}
+
+	if err := json.Unmarshal(plain, &store.secrets); err != nil {
+		return nil, fmt.Errorf("Unable to read secrets file %s - %s", path, err)
+	}
+
+	return store, nil
+}
+
+func newCipher(passphrase []byte, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, keyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (s *FileStore) Get(secretType string, key string) (string, error) {
+	if st, ok := s.secrets[secretType]; ok {
+		if val, ok := st[key]; ok {
+			return val, nil
+		}
+	}
+
+	return "", fmt.Errorf("Failed to find %s secret for key %s", secretType, key)
+}
+
+// Set adds or replaces a secret. The store must be saved for the change to
+// be kept.
+func (s *FileStore) Set(secretType string, key string, value string) {
+	if _, ok := s.secrets[secretType]; !ok {
+		s.secrets[secretType] = make(map[string]string)
+	}
+
+	s.secrets[secretType][key] = value
+}
+
+// Remove deletes a secret. The store must be saved for the change to be kept.
+func (s *FileStore) Remove(secretType string, key string) error {
+	if _, err := s.Get(secretType, key); err != nil {
+		return err
+	}
+
+	delete(s.secrets[secretType], key)
+	if len(s.secrets[secretType]) == 0 {
+		delete(s.secrets, secretType)
+	}
+
+	return nil
+}
+
+// List returns the secrets within the store, ordered by type and key.
+func (s *FileStore) List() []Entry {
+	entries := []Entry{}
+	for t, keys := range s.secrets {
+		for k := range keys {
+			entries = append(entries, Entry{Type: t, Key: k})
+		}
+	}
+
+	sort.Sort(byTypeAndKey(entries))
+
+	return entries
+}
+
+// Save encrypts the store and writes it to its file, readable only by the
+// current user.
+func (s *FileStore) Save() error {
+	plain, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+
+	file := encryptedFile{
+		Version: fileFormatVersion,
+		Salt:    make([]byte, saltLength),
+	}
+	if _, err := io.ReadFull(rand.Reader, file.Salt); err != nil {
+		return err
+	}
+
+	gcm, err := newCipher(s.passphrase, file.Salt)
+	if err != nil {
+		return err
+	}
+
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, nil)
+
+	d, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(d)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// ReadKey returns the secrets key, either given directly or read from a key
+// file. Trailing whitespace within a key file is ignored.
+func ReadKey(key string, keyFile string) ([]byte, error) {
+	if len(key) != 0 && len(keyFile) != 0 {
+		return nil, fmt.Errorf("Only one of the secrets key or key file can be specified")
+	}
+
+	if len(keyFile) != 0 {
+		d, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read secrets key file %s - %s", keyFile, err)
+		}
+		return bytes.TrimRight(d, " \t\r\n"), nil
+	}
+
+	if len(key) == 0 {
+		return nil, fmt.Errorf("A secrets key or key file must be specified")
+	}
+
+	return []byte(key), nil
+}
+
+type byTypeAndKey []Entry
+
+func (e byTypeAndKey) Len() int      { return len(e) }
+func (e byTypeAndKey) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e byTypeAndKey) Less(i, j int) bool {
+	if e[i].Type != e[j].Type {
+		return e[i].Type < e[j].Type
+	}
+	return e[i].Key < e[j].Key
+}
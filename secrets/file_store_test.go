@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "secrets")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nested", "secrets")
+
+	store, err := OpenFileStore(path, []byte("correct horse"))
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Empty(store.List())
+
+	store.Set("password", "bintray", "p:a:s:s")
+	store.Set("password", "artifactory", "other")
+	store.Set("token", "github", "abc123")
+	assert.Nil(store.Save())
+
+	info, err := os.Stat(path)
+	if assert.Nil(err) {
+		assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	}
+
+	d, _ := ioutil.ReadFile(path)
+	assert.False(strings.Contains(string(d), "p:a:s:s"))
+
+	store, err = OpenFileStore(path, []byte("correct horse"))
+	if !assert.Nil(err) {
+		return
+	}
+
+	value, err := store.Get("password", "bintray")
+	assert.Nil(err)
+	assert.Equal("p:a:s:s", value)
+
+	assert.Equal([]Entry{
+		{Type: "password", Key: "artifactory"},
+		{Type: "password", Key: "bintray"},
+		{Type: "token", Key: "github"},
+	}, store.List())
+
+	assert.Nil(store.Remove("token", "github"))
+	assert.NotNil(store.Remove("token", "github"))
+	_, err = store.Get("token", "github")
+	assert.NotNil(err)
+
+	_, err = OpenFileStore(path, []byte("battery staple"))
+	assert.EqualError(err, "Unable to decrypt secrets file "+path+". Check the secrets key is correct")
+}
+
+func TestReadKey(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "secrets")
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	ioutil.WriteFile(keyFile, []byte("from a file\n"), 0600)
+
+	key, err := ReadKey("", keyFile)
+	assert.Nil(err)
+	assert.Equal("from a file", string(key))
+
+	key, err = ReadKey("direct", "")
+	assert.Nil(err)
+	assert.Equal("direct", string(key))
+
+	_, err = ReadKey("direct", keyFile)
+	assert.NotNil(err)
+
+	_, err = ReadKey("", "")
+	assert.NotNil(err)
+}
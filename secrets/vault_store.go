@@ -0,0 +1,223 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultVaultMount = "secret"
+	defaultVaultField = "value"
+)
+
+// VaultConfig describes how to reach a Vault-style KV secrets engine. Either
+// Token or both RoleId and SecretId must be given.
+type VaultConfig struct {
+	Address string
+	// Mount is the path the KV engine is mounted at. Defaults to secret.
+	Mount string
+	// KVVersion is the version of the KV engine, either 1 or 2. Defaults to 2.
+	KVVersion int
+	// Field is the field of the secret holding the value. Defaults to value.
+	Field    string
+	Token    string
+	RoleId   string
+	SecretId string
+	Client   *http.Client
+}
+
+// VaultStore retrieves secrets from a Vault-style KV secrets engine. The
+// secret of type and key is read from <mount>/<type>/<key>. Secrets are
+// cached for the lifetime of the store.
+type VaultStore struct {
+	config VaultConfig
+	mu     sync.Mutex
+	token  string
+	cache  map[string]string
+}
+
+func NewVaultStore(config VaultConfig) (*VaultStore, error) {
+	if len(config.Address) == 0 {
+		return nil, fmt.Errorf("A vault address must be specified")
+	}
+
+	if len(config.Token) == 0 && (len(config.RoleId) == 0 || len(config.SecretId) == 0) {
+		return nil, fmt.Errorf("A vault token or AppRole role id and secret id must be specified")
+	}
+
+	if len(config.Mount) == 0 {
+		config.Mount = defaultVaultMount
+	}
+
+	if config.KVVersion == 0 {
+		config.KVVersion = 2
+	} else if config.KVVersion != 1 && config.KVVersion != 2 {
+		return nil, fmt.Errorf("Vault KV version %d is not supported. Available options 1, 2", config.KVVersion)
+	}
+
+	if len(config.Field) == 0 {
+		config.Field = defaultVaultField
+	}
+
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &VaultStore{
+		config: config,
+		token:  config.Token,
+		cache:  make(map[string]string),
+	}, nil
+}
+
+func (s *VaultStore) Get(secretType string, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.secretPath(secretType, key)
+	if value, ok := s.cache[path]; ok {
+		return value, nil
+	}
+
+	if len(s.token) == 0 {
+		if err := s.login(); err != nil {
+			return "", err
+		}
+	}
+
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	status, err := s.request("GET", path, nil, &response)
+	if status == http.StatusForbidden && s.usesAppRole() {
+		// The token may have expired, so log in again and retry once
+		s.token = ""
+		if err := s.login(); err != nil {
+			return "", err
+		}
+		status, err = s.request("GET", path, nil, &response)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if status == http.StatusNotFound {
+		return "", fmt.Errorf("Failed to find %s secret for key %s. Nothing exists at vault path %s", secretType, key, path)
+	}
+
+	data := response.Data
+	if s.config.KVVersion == 2 {
+		nested, _ := data["data"].(map[string]interface{})
+		data = nested
+	}
+
+	value, ok := data[s.config.Field].(string)
+	if !ok {
+		return "", fmt.Errorf("Vault path %s for %s secret %s has no %s field", path, secretType, key, s.config.Field)
+	}
+
+	s.cache[path] = value
+	return value, nil
+}
+
+func (s *VaultStore) secretPath(secretType string, key string) string {
+	mount := strings.Trim(s.config.Mount, "/")
+	if s.config.KVVersion == 2 {
+		return fmt.Sprintf("%s/data/%s/%s", mount, pathEscape(secretType), pathEscape(key))
+	}
+
+	return fmt.Sprintf("%s/%s/%s", mount, pathEscape(secretType), pathEscape(key))
+}
+
+func (s *VaultStore) usesAppRole() bool {
+	return len(s.config.RoleId) != 0 && len(s.config.SecretId) != 0
+}
+
+// pathEscape escapes s for use as a single segment of a path.
+func pathEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// login exchanges the AppRole credentials for a token.
+func (s *VaultStore) login() error {
+	body := map[string]string{
+		"role_id":   s.config.RoleId,
+		"secret_id": s.config.SecretId,
+	}
+
+	var response struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+
+	status, err := s.request("POST", "auth/approle/login", body, &response)
+	if err != nil {
+		return fmt.Errorf("Unable to log in to vault with AppRole - %s", err)
+	}
+
+	if status == http.StatusNotFound || len(response.Auth.ClientToken) == 0 {
+		return fmt.Errorf("Unable to log in to vault with AppRole - no token was returned")
+	}
+
+	s.token = response.Auth.ClientToken
+	return nil
+}
+
+// request sends a request to the vault API, decoding a successful response
+// into result. A not found response is returned without an error so callers
+// can describe what was missing.
+func (s *VaultStore) request(method string, path string, body interface{}, result interface{}) (int, error) {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+
+	u := strings.TrimRight(s.config.Address, "/") + "/v1/" + path
+	req, err := http.NewRequest(method, u, &payload)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(s.token) != 0 {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := s.config.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return res.StatusCode, nil
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(res.Body).Decode(&vaultErr)
+		if len(vaultErr.Errors) != 0 {
+			return res.StatusCode, fmt.Errorf("Vault returned %d for %s - %s", res.StatusCode, path, strings.Join(vaultErr.Errors, ", "))
+		}
+		return res.StatusCode, fmt.Errorf("Vault returned %d for %s", res.StatusCode, path)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return res.StatusCode, fmt.Errorf("Unable to read vault response for %s - %s", path, err)
+	}
+
+	return res.StatusCode, nil
+}
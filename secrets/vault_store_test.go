@@ -0,0 +1,154 @@
+package secrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeVault struct {
+	requests map[string]int
+	secrets  map[string]interface{}
+}
+
+func newFakeVault() (*fakeVault, *httptest.Server) {
+	v := &fakeVault{
+		requests: make(map[string]int),
+		secrets:  make(map[string]interface{}),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v.requests[r.Method+" "+r.URL.Path]++
+
+		if r.URL.Path == "/v1/auth/approle/login" {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["role_id"] != "role" || body["secret_id"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"invalid role or secret ID"}})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]string{"client_token": "approle-token"}})
+			return
+		}
+
+		token := r.Header.Get("X-Vault-Token")
+		if token != "root" && token != "approle-token" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+
+		secret, ok := v.secrets[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{}})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": secret})
+	}))
+
+	return v, server
+}
+
+func TestVaultStore_GetWithToken(t *testing.T) {
+	assert := assert.New(t)
+
+	vault, server := newFakeVault()
+	defer server.Close()
+	vault.secrets["/v1/secret/data/password/bintray-user"] = map[string]interface{}{
+		"data": map[string]interface{}{"value": "p4ss"},
+	}
+
+	store, err := NewVaultStore(VaultConfig{Address: server.URL, Token: "root"})
+	if !assert.Nil(err) {
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		value, err := store.Get("password", "bintray-user")
+		if assert.Nil(err) {
+			assert.Equal("p4ss", value)
+		}
+	}
+	assert.Equal(1, vault.requests["GET /v1/secret/data/password/bintray-user"])
+
+	_, err = store.Get("password", "missing")
+	assert.EqualError(err, "Failed to find password secret for key missing. Nothing exists at vault path secret/data/password/missing")
+}
+
+func TestVaultStore_GetWithAppRole(t *testing.T) {
+	assert := assert.New(t)
+
+	vault, server := newFakeVault()
+	defer server.Close()
+	vault.secrets["/v1/kv/password/bintray-user"] = map[string]interface{}{"password": "p4ss"}
+
+	store, err := NewVaultStore(VaultConfig{
+		Address:   server.URL,
+		Mount:     "kv",
+		KVVersion: 1,
+		Field:     "password",
+		RoleId:    "role",
+		SecretId:  "secret",
+	})
+	if !assert.Nil(err) {
+		return
+	}
+
+	value, err := store.Get("password", "bintray-user")
+	if assert.Nil(err) {
+		assert.Equal("p4ss", value)
+	}
+	assert.Equal(1, vault.requests["POST /v1/auth/approle/login"])
+
+	vault.secrets["/v1/kv/password/no-field"] = map[string]interface{}{"other": "x"}
+	_, err = store.Get("password", "no-field")
+	assert.EqualError(err, "Vault path kv/password/no-field for password secret no-field has no password field")
+}
+
+func TestVaultStore_LogsInAgainWhenTheAppRoleTokenExpires(t *testing.T) {
+	assert := assert.New(t)
+
+	vault, server := newFakeVault()
+	defer server.Close()
+	vault.secrets["/v1/secret/data/password/db"] = map[string]interface{}{"data": map[string]interface{}{"value": "p4ss"}}
+
+	store, err := NewVaultStore(VaultConfig{Address: server.URL, RoleId: "role", SecretId: "secret"})
+	if !assert.Nil(err) {
+		return
+	}
+	store.token = "expired-token"
+
+	value, err := store.Get("password", "db")
+	if assert.Nil(err) {
+		assert.Equal("p4ss", value)
+	}
+	assert.Equal(1, vault.requests["POST /v1/auth/approle/login"])
+	assert.Equal(2, vault.requests["GET /v1/secret/data/password/db"])
+}
+
+func TestVaultStore_Errors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, server := newFakeVault()
+	defer server.Close()
+
+	store, _ := NewVaultStore(VaultConfig{Address: server.URL, Token: "wrong"})
+	_, err := store.Get("password", "bintray-user")
+	assert.EqualError(err, "Vault returned 403 for secret/data/password/bintray-user - permission denied")
+
+	store, _ = NewVaultStore(VaultConfig{Address: server.URL, RoleId: "role", SecretId: "wrong"})
+	_, err = store.Get("password", "bintray-user")
+	assert.EqualError(err, "Unable to log in to vault with AppRole - Vault returned 400 for auth/approle/login - invalid role or secret ID")
+
+	_, err = NewVaultStore(VaultConfig{Address: server.URL})
+	assert.NotNil(err)
+
+	_, err = NewVaultStore(VaultConfig{Address: server.URL, Token: "root", KVVersion: 3})
+	assert.NotNil(err)
+}
@@ -66,6 +66,7 @@ func newAgent(agentId uuid.UUID, conn AgentConnection, logger *log.Logger) *Agen
 		agent.send(&messages.BuildGitRepository{
 			Url:    msg.Url,
 			Commit: msg.Commit,
+			Params: msg.Params,
 		})
 	})
 
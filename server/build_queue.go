@@ -22,6 +22,7 @@ type buildGitRepositoryJob struct {
 	submissionDate time.Time
 	Url            string
 	Commit         string
+	Params         map[string]string
 }
 
 func (bj *buildGitRepositoryJob) Id() uuid.UUID {
@@ -32,10 +33,11 @@ func (bj *buildGitRepositoryJob) SubmissionDate() time.Time {
 	return bj.submissionDate
 }
 
-func NewBuildGitRepositoryJob(url string, commit string) BuildJob {
+func NewBuildGitRepositoryJob(url string, commit string, params map[string]string) BuildJob {
 	return &buildGitRepositoryJob{
 		Url:            url,
 		Commit:         commit,
+		Params:         params,
 		id:             uuid.NewV4(),
 		submissionDate: time.Now(),
 	}
@@ -2,7 +2,9 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"path/filepath"
 
 	"github.com/gorilla/mux"
 	"github.com/lukesmith/cimple/database"
@@ -32,9 +34,23 @@ type buildsItemModel struct {
 	BuildUrl       string    `json:"build_url"`
 }
 
-type submitBuildModel struct {
+type artifactModel struct {
+	Task   string `json:"task"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
 	Url    string `json:"url"`
-	Commit string `json:"commit"`
+}
+
+type artifactsModel struct {
+	Id        string           `json:"id"`
+	Artifacts []*artifactModel `json:"artifacts"`
+}
+
+type submitBuildModel struct {
+	Url    string            `json:"url"`
+	Commit string            `json:"commit"`
+	Params map[string]string `json:"params"`
 }
 
 func registerBuilds(app *web_application.Application, db database.CimpleDatabase, buildQueue BuildQueue, logger *log.Logger) {
@@ -47,6 +63,9 @@ func registerBuilds(app *web_application.Application, db database.CimpleDatabase
 	app.Handle("/builds/{key}", handler.getDetails).Methods("GET").Name("build")
 	app.Handle("/builds", handler.listBuilds).Methods("GET").Name("listBuilds")
 	app.Handle("/builds", handler.submitBuild).Methods("POST").Name("submitBuild")
+	app.Handle("/builds/{key}/artifacts", handler.listArtifacts).Methods("GET").Name("buildArtifacts")
+	app.Router.HandleFunc("/builds/{key}/artifacts/{path:.+}", handler.downloadArtifact).Methods("GET").Name("buildArtifact")
+	app.Handle("/builds/{key}/artifacts/{path:.+}", handler.uploadArtifact).Methods("PUT").Name("uploadBuildArtifact")
 }
 
 func (h *buildsHandler) listBuilds(app *web_application.Application, w http.ResponseWriter, r *http.Request) (interface{}, error) {
@@ -82,7 +101,7 @@ func (h *buildsHandler) submitBuild(app *web_application.Application, w http.Res
 		return nil, err
 	} else {
 		w.WriteHeader(http.StatusAccepted)
-		job := NewBuildGitRepositoryJob(submitModel.Url, submitModel.Commit)
+		job := NewBuildGitRepositoryJob(submitModel.Url, submitModel.Commit, submitModel.Params)
 
 		h.buildQueue.Queue(job)
 
@@ -118,3 +137,74 @@ func (h *buildsHandler) getDetails(app *web_application.Application, w http.Resp
 		BuildOutput: string(bo),
 	}, nil
 }
+
+func (h *buildsHandler) listArtifacts(app *web_application.Application, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	params := mux.Vars(r)
+
+	build, err := h.db.FindBuild(params["key"])
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := build.GetArtifacts()
+	if err != nil {
+		return nil, err
+	}
+
+	model := artifactsModel{
+		Id:        build.Id,
+		Artifacts: []*artifactModel{},
+	}
+
+	for _, a := range manifest.Artifacts {
+		artifactUrl, _ := app.Router.Get("buildArtifact").URL("key", build.Id, "path", a.Path)
+
+		model.Artifacts = append(model.Artifacts, &artifactModel{
+			Task:   a.Task,
+			Path:   a.Path,
+			Size:   a.Size,
+			Sha256: a.Sha256,
+			Url:    artifactUrl.String(),
+		})
+	}
+
+	return model, nil
+}
+
+func (h *buildsHandler) downloadArtifact(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	build, err := h.db.FindBuild(params["key"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	path, err := build.ArtifactPath(params["path"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	http.ServeFile(w, r, path)
+}
+
+func (h *buildsHandler) uploadArtifact(app *web_application.Application, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	params := mux.Vars(r)
+
+	project := r.URL.Query().Get("project")
+	if len(project) == 0 {
+		return nil, fmt.Errorf("A project must be specified to upload an artifact")
+	}
+
+	err := h.db.SaveArtifact(project, params["key"], params["path"], r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	h.logger.Printf("Received artifact %s for build %s", params["path"], params["key"])
+	w.WriteHeader(http.StatusCreated)
+
+	return nil, nil
+}
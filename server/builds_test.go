@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/lukesmith/cimple/artifacts"
+	"github.com/lukesmith/cimple/database"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -70,7 +74,7 @@ func Test_SubmitBuild(t *testing.T) {
 func Test_ListBuilds(t *testing.T) {
 	app, server := newWebApplication()
 	buildQueue := &fakeBuildQueue{}
-	queuedItem := NewBuildGitRepositoryJob("https://test.git", "master")
+	queuedItem := NewBuildGitRepositoryJob("https://test.git", "master", nil)
 	buildQueue.queued = []BuildJob{queuedItem}
 	registerBuilds(app, nil, buildQueue, log.New(os.Stdout, "", 0))
 
@@ -97,3 +101,102 @@ func Test_ListBuilds(t *testing.T) {
 		assert.Equal("http://cimple.test/builds/"+queuedItem.Id().String(), m[0]["build_url"])
 	}
 }
+
+func Test_UploadAndListArtifacts(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "cimple")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "cimple", "1234"), 0755)
+
+	app, server := newWebApplication()
+	db := database.NewDatabase(dir)
+	registerBuilds(app, db, &fakeBuildQueue{}, log.New(os.Stdout, "", 0))
+
+	manifest, _ := json.Marshal(&artifacts.Manifest{
+		Artifacts: []artifacts.Artifact{
+			{Task: "package", Path: "output/cimple.tar.gz", Size: 5, Sha256: "abc"},
+		},
+	})
+
+	uploads := map[string]string{
+		"output/cimple.tar.gz": "hello",
+		artifacts.ManifestFile: string(manifest),
+	}
+
+	for path, content := range uploads {
+		url := fmt.Sprintf("%s/builds/1234/artifacts/%s?project=cimple", server.URL, path)
+		request, _ := http.NewRequest("PUT", url, bytes.NewBufferString(content))
+		request.Header.Add("Accept", "application/json")
+
+		res, err := http.DefaultClient.Do(request)
+		if assert.Nil(err) {
+			assert.Equal(201, res.StatusCode, "Created expected")
+		}
+	}
+
+	request, _ := http.NewRequest("GET", fmt.Sprintf("%s/builds/1234/artifacts", server.URL), nil)
+	request.Header.Add("Accept", "application/json")
+
+	res, err := http.DefaultClient.Do(request)
+	if assert.Nil(err) {
+		assert.Equal(200, res.StatusCode, "OK expected")
+
+		var m map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&m)
+		assert.Equal("1234", m["id"])
+
+		listed := m["artifacts"].([]interface{})
+		if assert.Equal(1, len(listed)) {
+			artifact := listed[0].(map[string]interface{})
+			assert.Equal("output/cimple.tar.gz", artifact["path"])
+			assert.Equal("http://cimple.test/builds/1234/artifacts/output/cimple.tar.gz", artifact["url"])
+		}
+	}
+
+	request, _ = http.NewRequest("GET", fmt.Sprintf("%s/builds/1234/artifacts/output/cimple.tar.gz", server.URL), nil)
+	res, err = http.DefaultClient.Do(request)
+	if assert.Nil(err) {
+		assert.Equal(200, res.StatusCode, "OK expected")
+		body, _ := ioutil.ReadAll(res.Body)
+		assert.Equal("hello", string(body))
+	}
+}
+
+func Test_UploadArtifact_InvalidPath(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "cimple")
+	defer os.RemoveAll(dir)
+
+	app, server := newWebApplication()
+	registerBuilds(app, database.NewDatabase(dir), &fakeBuildQueue{}, log.New(os.Stdout, "", 0))
+
+	url := fmt.Sprintf("%s/builds/1234/artifacts/..%%2F..%%2Fescaped?project=cimple", server.URL)
+	request, _ := http.NewRequest("PUT", url, bytes.NewBufferString("content"))
+	request.Header.Add("Accept", "application/json")
+
+	res, err := http.DefaultClient.Do(request)
+	if assert.Nil(t, err) {
+		assert.NotEqual(t, 201, res.StatusCode)
+	}
+}
+
+func Test_UploadArtifact_UnknownBuild(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "cimple")
+	defer os.RemoveAll(dir)
+
+	app, server := newWebApplication()
+	registerBuilds(app, database.NewDatabase(dir), &fakeBuildQueue{}, log.New(os.Stdout, "", 0))
+
+	url := fmt.Sprintf("%s/builds/1234/artifacts/cimple.tar.gz?project=unknown", server.URL)
+	request, _ := http.NewRequest("PUT", url, bytes.NewBufferString("content"))
+	request.Header.Add("Accept", "application/json")
+
+	res, err := http.DefaultClient.Do(request)
+	if assert.Nil(t, err) {
+		assert.NotEqual(t, 201, res.StatusCode)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "unknown"))
+	assert.True(t, os.IsNotExist(err))
+}
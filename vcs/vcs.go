@@ -14,6 +14,7 @@ type VcsInformation struct {
 	Revision   string
 	RemoteUrl  string
 	RemoteName string
+	Tag        string
 }
 
 func LoadVcsInformation() (*VcsInformation, error) {
@@ -40,6 +41,11 @@ func LoadVcsInformation() (*VcsInformation, error) {
 		return nil, err
 	}
 
+	err = currentTag(info)
+	if err != nil {
+		return nil, err
+	}
+
 	return info, nil
 }
 
@@ -78,6 +84,18 @@ func remoteName(info *VcsInformation) error {
 	return nil
 }
 
+func currentTag(info *VcsInformation) error {
+	buf := &bytes.Buffer{}
+	err := executeGit("describe --tags --exact-match HEAD", buf)
+	if err != nil {
+		// HEAD is not tagged
+		return nil
+	}
+
+	info.Tag = strings.TrimRight(string(buf.Bytes()), "\n")
+	return nil
+}
+
 func currentHash(info *VcsInformation) error {
 	buf := &bytes.Buffer{}
 	err := executeGit("log -n 1 --pretty=format:%H", buf)